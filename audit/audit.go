@@ -0,0 +1,383 @@
+/*
+Package audit keeps a tamper-evident log of the signatures sputnik produces.
+
+The log is a JSONL file with one Entry per signature. Every entry holds the hash of its predecessor, so editing, removing or reordering entries
+breaks the chain. A head file next to the log records the number of entries, the hash of the last one and the size of the log, so that truncation is detected as well.
+Entries never contain request bodies, only their hashes.
+
+An entry is synced to disk before the head is replaced. A crash in between leaves one complete entry the head doesn't record yet, which the next
+Append adopts, and a crash while writing an entry leaves an incomplete last line. Repair handles both cases, `sputnik audit repair` runs it.
+*/
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// headFileSuffix is appended to the path of the log to get the path of its head file
+	headFileSuffix = ".head"
+	// folderMode is the mode of the folder a new log is created in
+	folderMode = os.FileMode(0700)
+	// fileMode is the mode of the log and its head file
+	fileMode = os.FileMode(0600)
+)
+
+// ErrTampered is returned when a log doesn't match its hash chain or its head file, e.g. because it was edited or truncated
+var ErrTampered = errors.New("the audit log has been tampered with")
+
+// Entry is a signature in the audit log
+type Entry struct {
+	// Sequence numbers the entries of a log, starting at 1
+	Sequence uint64 `json:"seq"`
+	// Time is the time the signature was produced, for requests the date that was signed
+	Time time.Time `json:"time"`
+	// Fingerprint is the fingerprint of the signing key's public key
+	Fingerprint string `json:"fingerprint"`
+	// KeyID is the CloudKit Key ID the signature was produced for
+	KeyID string `json:"key_id,omitempty"`
+	// Method is the HTTP method of a signed request
+	Method string `json:"method,omitempty"`
+	// Path is the subpath of a signed request
+	Path string `json:"path,omitempty"`
+	// BodyHash is the base64 encoded SHA-256 hash of a signed request's body
+	BodyHash string `json:"body_hash,omitempty"`
+	// MessageHash is the base64 encoded SHA-256 hash of a message that was signed outside of a request
+	MessageHash string `json:"message_hash,omitempty"`
+	// Previous is the Hash of the preceding entry, empty for the first entry
+	Previous string `json:"prev"`
+	// Hash is the hex encoded SHA-256 hash of the entry's JSON encoding without Hash
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of the entry, ignoring its Hash
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Head is the state of a log after its last entry
+type Head struct {
+	// Entries is the number of entries in the log
+	Entries uint64 `json:"entries"`
+	// Hash is the Hash of the last entry
+	Hash string `json:"hash"`
+	// Size is the size of the log in bytes
+	Size int64 `json:"size"`
+}
+
+// Log is an append-only, hash-chained audit log. It is safe for concurrent use, processes appending to the same log take turns.
+type Log struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// Open returns the log at the given path. The log and its folder are created with the first entry.
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the path of the log
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append chains the entry to the log. Sequence, Previous and Hash are set by the log.
+//
+// Entries are only appended to a log that still matches its head file, so that a tampered log is noticed at the next signature.
+// A single valid entry beyond the head, left by a crash before the head was written, is adopted.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), folderMode); err != nil {
+		return Entry{}, err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, fileMode)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+
+	unlock, err := lockFile(file)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer unlock()
+
+	head, err := readHead(l.path)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+	if info.Size() < head.Size {
+		return Entry{}, fmt.Errorf("%w: %s holds %d bytes, its head expects %d", ErrTampered, l.path, info.Size(), head.Size)
+	} else if info.Size() > head.Size {
+		tail := make([]byte, info.Size()-head.Size)
+		if _, err := file.ReadAt(tail, head.Size); err != nil {
+			return Entry{}, err
+		}
+		if head, err = adoptTrailingEntry(head, tail); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	entry.Sequence = head.Entries + 1
+	entry.Time = entry.Time.UTC()
+	entry.Previous = head.Hash
+	entry.Hash, err = entry.computeHash()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	line = append(line, '\n')
+	if _, err := file.Write(line); err != nil {
+		return Entry{}, err
+	}
+	if err := file.Sync(); err != nil {
+		return Entry{}, err
+	}
+
+	return entry, writeHead(l.path, Head{Entries: entry.Sequence, Hash: entry.Hash, Size: head.Size + int64(len(line))})
+}
+
+// Verify checks the hash chain of the log at the given path against its head file and returns the head of the verified log.
+//
+// It detects edited, removed, reordered and appended entries and a truncated log. A missing log without head file is an empty log.
+// Someone who can rewrite both the log and its head file can rewrite history, record the head elsewhere to detect that as well.
+// A crash while appending is reported as ErrTampered too, see Repair.
+func Verify(path string) (Head, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		head, err := readHead(path)
+		if err != nil {
+			return Head{}, err
+		} else if head != (Head{}) {
+			return Head{}, fmt.Errorf("%w: %s is missing", ErrTampered, path)
+		}
+		return head, nil
+	} else if err != nil {
+		return Head{}, err
+	}
+	defer file.Close()
+
+	unlock, err := lockFileShared(file)
+	if err != nil {
+		return Head{}, err
+	}
+	defer unlock()
+
+	head, err := readHead(path)
+	if err != nil {
+		return Head{}, err
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return Head{}, err
+	}
+
+	actual, err := verifyChain(data)
+	if err != nil {
+		return Head{}, err
+	}
+	if actual != head {
+		if int64(len(data)) > head.Size {
+			if _, err := adoptTrailingEntry(head, data[head.Size:]); err == nil {
+				return Head{}, fmt.Errorf("%w: the last entry isn't recorded in the head, e.g. after a crash, run `sputnik audit repair`", ErrTampered)
+			}
+		}
+		return Head{}, fmt.Errorf("%w: the log holds %d entries, its head expects %d", ErrTampered, actual.Entries, head.Entries)
+	}
+	return head, nil
+}
+
+// Repair brings the log at the given path back in line with its head file after a crash and returns the repaired head.
+//
+// The entries the head records are verified first. Beyond them, a single complete entry that follows the head is adopted and an incomplete
+// last line is removed. Anything else is reported as ErrTampered and left untouched.
+func Repair(path string) (Head, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, fileMode)
+	if err != nil {
+		return Head{}, err
+	}
+	defer file.Close()
+
+	unlock, err := lockFile(file)
+	if err != nil {
+		return Head{}, err
+	}
+	defer unlock()
+
+	head, err := readHead(path)
+	if err != nil {
+		return Head{}, err
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return Head{}, err
+	}
+	if int64(len(data)) < head.Size {
+		return Head{}, fmt.Errorf("%w: %s holds %d bytes, its head expects %d", ErrTampered, path, len(data), head.Size)
+	}
+	if actual, err := verifyChain(data[:head.Size]); err != nil {
+		return Head{}, err
+	} else if actual != head {
+		return Head{}, fmt.Errorf("%w: the log holds %d entries, its head expects %d", ErrTampered, actual.Entries, head.Entries)
+	}
+
+	tail := data[head.Size:]
+	if len(tail) == 0 {
+		return head, nil
+	}
+	if !bytes.Contains(tail, []byte{'\n'}) {
+		if err := file.Truncate(head.Size); err != nil {
+			return Head{}, err
+		}
+		return head, file.Sync()
+	}
+
+	repaired, err := adoptTrailingEntry(head, tail)
+	if err != nil {
+		return Head{}, err
+	}
+	return repaired, writeHead(path, repaired)
+}
+
+// verifyChain checks the hash chain of the entries in data and returns the head after the last one
+func verifyChain(data []byte) (Head, error) {
+	actual := Head{Size: int64(len(data))}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		entry := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return Head{}, fmt.Errorf("%w: entry %d can't be read (%s)", ErrTampered, actual.Entries+1, err)
+		}
+		if err := checkEntry(entry, actual); err != nil {
+			return Head{}, err
+		}
+
+		actual.Entries = entry.Sequence
+		actual.Hash = entry.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return Head{}, err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return Head{}, fmt.Errorf("%w: the last entry is incomplete", ErrTampered)
+	}
+	return actual, nil
+}
+
+// checkEntry checks that the entry directly follows the given head and that its hash is intact
+func checkEntry(entry Entry, previous Head) error {
+	if entry.Sequence != previous.Entries+1 {
+		return fmt.Errorf("%w: entry %d has the sequence number %d", ErrTampered, previous.Entries+1, entry.Sequence)
+	}
+	if entry.Previous != previous.Hash {
+		return fmt.Errorf("%w: entry %d doesn't follow its predecessor", ErrTampered, entry.Sequence)
+	}
+	hash, err := entry.computeHash()
+	if err != nil {
+		return err
+	}
+	if hash != entry.Hash {
+		return fmt.Errorf("%w: entry %d has been edited", ErrTampered, entry.Sequence)
+	}
+	return nil
+}
+
+// adoptTrailingEntry returns the head after the single entry in tail, the part of the log beyond the head's size, if it follows the head
+func adoptTrailingEntry(head Head, tail []byte) (Head, error) {
+	if len(tail) == 0 || bytes.IndexByte(tail, '\n') != len(tail)-1 {
+		return Head{}, fmt.Errorf("%w: the log holds %d bytes beyond its head", ErrTampered, len(tail))
+	}
+
+	entry := Entry{}
+	if err := json.Unmarshal(tail, &entry); err != nil {
+		return Head{}, fmt.Errorf("%w: the entry beyond the head can't be read (%s)", ErrTampered, err)
+	}
+	if err := checkEntry(entry, head); err != nil {
+		return Head{}, err
+	}
+	return Head{Entries: entry.Sequence, Hash: entry.Hash, Size: head.Size + int64(len(tail))}, nil
+}
+
+func headFilePath(path string) string {
+	return path + headFileSuffix
+}
+
+// readHead returns the head of the log, or an empty head if the log has none yet
+func readHead(path string) (Head, error) {
+	head := Head{}
+	data, err := ioutil.ReadFile(headFilePath(path))
+	if os.IsNotExist(err) {
+		return head, nil
+	} else if err != nil {
+		return head, err
+	}
+
+	if err := json.Unmarshal(data, &head); err != nil {
+		return Head{}, fmt.Errorf("%w: the head can't be read (%s)", ErrTampered, err)
+	}
+	return head, nil
+}
+
+// writeHead replaces the head file atomically, so that a crash never leaves a partially written head
+func writeHead(path string, head Head) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), ".tmp-"+filepath.Base(headFilePath(path))+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), headFilePath(path)); err != nil {
+		return err
+	}
+
+	// sync the rename, so that the head survives a crash together with the entry it records
+	if folder, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = folder.Sync()
+		folder.Close()
+	}
+	return nil
+}
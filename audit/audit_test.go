@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const logPath = "./testFiles/audit.jsonl"
+
+func appendEntries(t *testing.T, count int) *Log {
+	log := Open(logPath)
+	for i := 0; i < count; i++ {
+		_, err := log.Append(Entry{Time: time.Now(), Fingerprint: "SHA256:abc", KeyID: "key id", Method: "POST", Path: "/database/1/c/development/public/records/modify", BodyHash: "hash"})
+		assert.Nil(t, err)
+	}
+	return log
+}
+
+func TestAppendChainsEntries(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	log := Open(logPath)
+
+	first, err := log.Append(Entry{Fingerprint: "SHA256:abc"})
+	assert.Nil(t, err)
+	second, err := log.Append(Entry{Fingerprint: "SHA256:abc"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(1), first.Sequence)
+	assert.Equal(t, "", first.Previous)
+	assert.Equal(t, uint64(2), second.Sequence)
+	assert.Equal(t, first.Hash, second.Previous)
+
+	head, err := Verify(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), head.Entries)
+	assert.Equal(t, second.Hash, head.Hash)
+}
+
+func TestVerifyMissingLog(t *testing.T) {
+	head, err := Verify("./testFiles/missing.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), head.Entries)
+}
+
+func TestVerifyDetectsEditedEntries(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	appendEntries(t, 3)
+
+	data, _ := ioutil.ReadFile(logPath)
+	edited := strings.Replace(string(data), `"method":"POST"`, `"method":"GET"`, 1)
+	assert.Nil(t, ioutil.WriteFile(logPath, []byte(edited), 0600))
+
+	_, err := Verify(logPath)
+	assert.True(t, errors.Is(err, ErrTampered), "An edited entry should be detected")
+}
+
+func TestVerifyDetectsRemovedEntries(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	appendEntries(t, 3)
+
+	data, _ := ioutil.ReadFile(logPath)
+	lines := strings.SplitAfter(string(data), "\n")
+	assert.Nil(t, ioutil.WriteFile(logPath, []byte(lines[0]+lines[2]), 0600))
+
+	_, err := Verify(logPath)
+	assert.True(t, errors.Is(err, ErrTampered), "A removed entry should be detected")
+}
+
+func TestVerifyDetectsTruncation(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	log := appendEntries(t, 3)
+
+	data, _ := ioutil.ReadFile(logPath)
+	lines := strings.SplitAfter(string(data), "\n")
+	assert.Nil(t, ioutil.WriteFile(logPath, []byte(lines[0]+lines[1]), 0600))
+
+	_, err := Verify(logPath)
+	assert.True(t, errors.Is(err, ErrTampered), "A truncated log should be detected")
+
+	_, err = log.Append(Entry{Fingerprint: "SHA256:abc"})
+	assert.True(t, errors.Is(err, ErrTampered), "Nothing should be appended to a truncated log")
+}
+
+func TestVerifyDetectsMissingHead(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	appendEntries(t, 1)
+	assert.Nil(t, os.Remove(headFilePath(logPath)))
+
+	_, err := Verify(logPath)
+	assert.True(t, errors.Is(err, ErrTampered))
+}
+
+func TestConcurrentAppends(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	log := Open(logPath)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := log.Append(Entry{Fingerprint: "SHA256:abc"})
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	head, err := Verify(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), head.Entries)
+}
+
+// crashBeforeHead appends an entry but restores the previous head, like a crash between writing the entry and its head
+func crashBeforeHead(t *testing.T, log *Log) {
+	head, _ := ioutil.ReadFile(headFilePath(logPath))
+	_, err := log.Append(Entry{Fingerprint: "SHA256:abc"})
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(headFilePath(logPath), head, 0600))
+}
+
+func TestAppendAdoptsEntryMissingFromHead(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	log := appendEntries(t, 2)
+	crashBeforeHead(t, log)
+
+	_, err := Verify(logPath)
+	assert.True(t, errors.Is(err, ErrTampered))
+
+	entry, err := log.Append(Entry{Fingerprint: "SHA256:abc"})
+	assert.Nil(t, err, "An entry written right before a crash should be adopted")
+	assert.Equal(t, uint64(4), entry.Sequence)
+	head, err := Verify(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), head.Entries)
+}
+
+func TestRepairAdoptsEntryMissingFromHead(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	log := appendEntries(t, 2)
+	crashBeforeHead(t, log)
+
+	head, err := Repair(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), head.Entries)
+	verified, err := Verify(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, head, verified)
+}
+
+func TestRepairRemovesIncompleteEntry(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	appendEntries(t, 2)
+	file, _ := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = file.WriteString(`{"seq":3,"time":`)
+	file.Close()
+
+	head, err := Repair(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), head.Entries)
+	_, err = Verify(logPath)
+	assert.Nil(t, err)
+}
+
+func TestRepairRefusesTamperedLog(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	log := appendEntries(t, 1)
+	head, _ := ioutil.ReadFile(headFilePath(logPath))
+	appendEntries(t, 2)
+	assert.Nil(t, ioutil.WriteFile(headFilePath(logPath), head, 0600))
+
+	_, err := Repair(logPath)
+	assert.True(t, errors.Is(err, ErrTampered), "Only a single entry beyond the head can be left by a crash")
+	_, err = log.Append(Entry{Fingerprint: "SHA256:abc"})
+	assert.True(t, errors.Is(err, ErrTampered))
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// lockFile is a no-op on platforms without flock. Appends within a process are still serialized, but appends of concurrent processes aren't.
+func lockFile(file *os.File) (func(), error) {
+	return func() {}, nil
+}
+
+// lockFileShared is a no-op on platforms without flock
+func lockFileShared(file *os.File) (func(), error) {
+	return func() {}, nil
+}
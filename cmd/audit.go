@@ -0,0 +1,68 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/audit"
+	"github.com/q231950/sputnik/requesthandling"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log of produced signatures",
+	Long: `With --audit-log, or the audit_log config key, every signature sputnik produces is appended to a hash-chained audit log.
+	Each entry holds the time, the key fingerprint, the key ID, the HTTP method, the path and the hash of the body, never the body itself.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+	RootCmd.PersistentFlags().String("audit-log", "", "a file to append every produced signature to, see `sputnik help audit` (see also `SPUTNIK_AUDIT_LOG`)")
+
+	viper.BindPFlag("audit_log", RootCmd.PersistentFlags().Lookup("audit-log"))
+}
+
+// requestOptions returns the options for request managers of the CLI, e.g. the audit log given by --audit-log
+func requestOptions() []requesthandling.Option {
+	options := []requesthandling.Option{}
+	if path := viper.GetString("audit_log"); len(path) > 0 {
+		options = append(options, requesthandling.WithAuditLog(audit.Open(path)))
+	}
+	return options
+}
+
+// auditLogPath returns the audit log given as argument or, without one, by --audit-log
+func auditLogPath(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	path := viper.GetString("audit_log")
+	if len(path) == 0 {
+		log.Error("Missing audit log, please provide one. See `sputnik help audit verify`")
+	}
+	return path
+}
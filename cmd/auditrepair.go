@@ -0,0 +1,58 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"os"
+
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/audit"
+	"github.com/spf13/cobra"
+)
+
+// auditrepairCmd represents the audit repair command
+var auditrepairCmd = &cobra.Command{
+	Use:   "repair [file]",
+	Short: "Repairs the audit log after a crash",
+	Long: `A crash while a signature is logged can leave the audit log out of line with its head file, which 'audit verify' reports as tampering.
+
+	Repair adopts a complete last entry the head doesn't record yet and removes an incomplete last line.
+	The entries the head records are verified first. Logs that differ in any other way are left untouched.
+
+	Without a file, the audit log given by --audit-log or the audit_log config key is repaired.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := auditLogPath(args)
+		if len(path) == 0 {
+			os.Exit(1)
+		}
+
+		head, err := audit.Repair(path)
+		if err != nil {
+			log.Errorf("Failed to repair the audit log (%s)", err)
+			os.Exit(1)
+		}
+		log.WithField("head", head.Hash).Infof("The audit log %s holds %d intact entries", path, head.Entries)
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditrepairCmd)
+}
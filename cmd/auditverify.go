@@ -0,0 +1,58 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/audit"
+	"github.com/spf13/cobra"
+)
+
+// auditverifyCmd represents the audit verify command
+var auditverifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Verifies that the audit log hasn't been tampered with",
+	Long: `Checks the hash chain of the audit log and compares it with the head file next to it.
+	Edited, removed and reordered entries are detected, as well as a truncated log. After a crash, run 'audit repair' first.
+
+	Without a file, the audit log given by --audit-log or the audit_log config key is verified.
+	The head hash this command shows can be recorded elsewhere, so that later rewrites of the whole log are detected as well.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := auditLogPath(args)
+		if len(path) == 0 {
+			os.Exit(1)
+		}
+
+		head, err := audit.Verify(path)
+		if err != nil {
+			log.Errorf("%s", err)
+			os.Exit(1)
+		}
+		log.WithField("head", head.Hash).Infof("The audit log %s holds %d intact entries", path, head.Entries)
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditverifyCmd)
+}
@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/q231950/sputnik/requesthandling"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,6 +17,11 @@ func TestRootCommand(t *testing.T) {
 	assert.NotNil(t, flag)
 }
 
+func TestRootCommandSecretsDirFlag(t *testing.T) {
+	flag := RootCmd.Flag("secrets-dir")
+	assert.NotNil(t, flag)
+}
+
 func TestRequestsCommand(t *testing.T) {
 	run := requestsCmd.Run
 	assert.NotNil(t, run)
@@ -35,3 +46,160 @@ func TestPostRequestCommandOperationFlag(t *testing.T) {
 	flag := postCmd.Flag("operation")
 	assert.NotNil(t, flag)
 }
+
+func TestRootCommandProfileFlag(t *testing.T) {
+	flag := RootCmd.PersistentFlags().Lookup("profile")
+	assert.NotNil(t, flag)
+}
+
+func TestRequestsSubcommandsInheritProfileFlag(t *testing.T) {
+	assert.NotNil(t, postCmd.InheritedFlags().Lookup("profile"))
+	assert.NotNil(t, getCmd.InheritedFlags().Lookup("profile"))
+}
+
+func TestIdentityCreateCommandNameFlag(t *testing.T) {
+	flag := createCmd.Flag("name")
+	assert.NotNil(t, flag)
+}
+
+func TestIdentityListCommand(t *testing.T) {
+	run := identitylistCmd.Run
+	assert.NotNil(t, run)
+}
+
+func TestIdentityUseCommand(t *testing.T) {
+	run := identityuseCmd.Run
+	assert.NotNil(t, run)
+}
+
+func TestIdentityCreateCommandEncryptFlag(t *testing.T) {
+	flag := createCmd.Flag("encrypt")
+	assert.NotNil(t, flag)
+}
+
+func TestRootCommandPassphraseFileFlag(t *testing.T) {
+	flag := RootCmd.PersistentFlags().Lookup("passphrase-file")
+	assert.NotNil(t, flag)
+}
+
+func TestPassphraseFileWinsOverEnvironment(t *testing.T) {
+	t.Setenv("SPUTNIK_KEY_PASSPHRASE", "from environment")
+	file := t.TempDir() + "/passphrase"
+	_ = os.WriteFile(file, []byte("from file\n"), 0600)
+	passphraseFile = file
+	defer func() { passphraseFile = "" }()
+
+	passphrase, err := passphraseProvider()()
+	assert.Nil(t, err)
+	assert.Equal(t, "from file", string(passphrase), "An explicit --passphrase-file should win over SPUTNIK_KEY_PASSPHRASE")
+}
+
+func TestIdentityEncryptCommands(t *testing.T) {
+	assert.NotNil(t, identityencryptCmd.Run)
+	assert.NotNil(t, identitydecryptCmd.Run)
+}
+
+func TestRootCommandKeyFlags(t *testing.T) {
+	assert.NotNil(t, RootCmd.PersistentFlags().Lookup("key-file"))
+	assert.NotNil(t, RootCmd.PersistentFlags().Lookup("key-id"))
+}
+
+func TestIdentityCreateCommandPKCS11Flag(t *testing.T) {
+	assert.NotNil(t, createCmd.Flag("pkcs11"))
+	assert.NotNil(t, RootCmd.PersistentFlags().Lookup("pkcs11-module"))
+	assert.NotNil(t, RootCmd.PersistentFlags().Lookup("pkcs11-token"))
+	assert.NotNil(t, RootCmd.PersistentFlags().Lookup("pkcs11-key-label"))
+}
+
+func TestIdentityImportCommand(t *testing.T) {
+	assert.NotNil(t, identityimportCmd.Run)
+	assert.NotNil(t, identityimportCmd.Flag("encrypt"))
+}
+
+func TestIdentityExportAndRestoreCommands(t *testing.T) {
+	assert.NotNil(t, identityexportCmd.Run)
+	assert.NotNil(t, identityexportCmd.Flag("out"))
+	assert.NotNil(t, identityrestoreCmd.Run)
+}
+
+func TestIdentityRotateCommand(t *testing.T) {
+	assert.NotNil(t, identityrotateCmd.Run)
+	assert.NotNil(t, identityrotateCmd.Flag("grace-period"))
+	assert.NotNil(t, identityrotateCmd.LocalFlags().Lookup("new-key-id"))
+}
+
+func TestIdentityFixPermissionsCommand(t *testing.T) {
+	assert.NotNil(t, identityfixpermissionsCmd.Run)
+	assert.NotNil(t, identityfixpermissionsCmd.Flag("dry-run"))
+}
+
+func TestIdentityMetadataCommand(t *testing.T) {
+	assert.NotNil(t, identitymetadataCmd.Run)
+	assert.NotNil(t, identitymetadataCmd.Flag("container"))
+	assert.NotNil(t, identitymetadataCmd.Flag("environment"))
+	assert.NotNil(t, identitymetadataCmd.Flag("note"))
+}
+
+func TestIdentityRemovalCommands(t *testing.T) {
+	assert.NotNil(t, identitydeleteCmd.Flag("yes"))
+	assert.NotNil(t, identityrestoreremovedCmd.Run)
+	assert.NotNil(t, identityrestoreremovedCmd.Flag("list"))
+	assert.NotNil(t, identitypurgeCmd.Run)
+	assert.NotNil(t, identitypurgeCmd.Flag("yes"))
+}
+
+func TestIdentityBindCommand(t *testing.T) {
+	assert.NotNil(t, identitybindCmd.Run)
+	assert.NotNil(t, identitybindCmd.Flag("container"))
+	assert.NotNil(t, identitybindCmd.Flag("environment"))
+	assert.NotNil(t, identitybindCmd.LocalFlags().Lookup("profile"))
+	assert.NotNil(t, identitybindCmd.LocalFlags().Lookup("key-id"))
+	assert.NotNil(t, identitybindCmd.Flag("list"))
+	assert.NotNil(t, identitybindCmd.Flag("remove"))
+}
+
+func TestIdentityCredentialHelperCommand(t *testing.T) {
+	assert.NotNil(t, identitycredentialhelperCmd.Run)
+	assert.NotNil(t, identitycredentialhelperCmd.Flag("unset"))
+}
+
+func TestAuditCommands(t *testing.T) {
+	assert.NotNil(t, RootCmd.Flag("audit-log"))
+	assert.NotNil(t, auditverifyCmd.Run)
+	assert.NotNil(t, auditrepairCmd.Run)
+}
+
+func TestRequestsEnvironmentFlags(t *testing.T) {
+	assert.NotNil(t, postCmd.Flag("environment"))
+	assert.NotNil(t, getCmd.Flag("environment"))
+	assert.NotNil(t, postCmd.Flag("allow-production-writes"))
+}
+
+func TestRequestsEndpointFlag(t *testing.T) {
+	assert.NotNil(t, postCmd.Flag("endpoint"))
+	assert.NotNil(t, getCmd.Flag("endpoint"))
+}
+
+func TestSendRetriesRejectedRequestWithPreviousIdentity(t *testing.T) {
+	folder := t.TempDir()
+	manager := keymanager.NewWithSecretsFolder(folder, "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.StoreKeyID("old key id")
+	_, _ = manager.StageSigningIdentity(nil)
+	_ = manager.CompleteRotation("new key id", time.Hour)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Apple-CloudKit-Request-KeyID") != "old key id" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	config := requesthandling.NewRequestConfig("1", "iCloud.container", "public")
+	config.BaseURL = server.URL
+	resp, err := send(requesthandling.New(config, &manager), func(requestManager requesthandling.CloudkitRequestManager) (*http.Request, error) {
+		return requestManager.PostRequest("query", "{}")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "A rejected request should be sent again with the previous identity")
+}
@@ -24,6 +24,7 @@ import (
 	log "github.com/apex/log"
 
 	"github.com/q231950/sputnik/keymanager"
+	"github.com/q231950/sputnik/keymanager/pkcs11"
 	"github.com/spf13/cobra"
 )
 
@@ -31,35 +32,99 @@ import (
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Creates a new signing identity",
-	Long:  `For now, a file named eckey.pem will be put into the secrets folder.`,
+	Long: `For now, a file named eckey.pem will be put into the secrets folder.
+
+	Use --name to create the identity in a named profile, e.g. one per container or environment:
+	./sputnik identity create --name production
+
+	Use --encrypt to store the private key encrypted with a passphrase. The passphrase is taken from
+	--passphrase-file, SPUTNIK_KEY_PASSPHRASE or a prompt.
+
+	Use --pkcs11 to generate the key inside a PKCS#11 token, e.g. an HSM, instead of the secrets folder:
+	SPUTNIK_PKCS11_PIN=<pin> ./sputnik identity create --pkcs11 --pkcs11-module /usr/lib/softhsm/libsofthsm2.so --pkcs11-token <token label>`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Infof("Attempting to create a new identity...")
-		createECKey()
+		if createInToken {
+			createTokenKey()
+		} else {
+			createECKey()
+		}
 	},
 }
 
+var identityName string
+var encryptIdentity bool
+var createInToken bool
+
 func init() {
 	eckeyCmd.AddCommand(createCmd)
+	createCmd.Flags().StringVarP(&identityName, "name", "n", "", "The name of the profile to create the identity in (default is the active profile)")
+	createCmd.Flags().BoolVarP(&encryptIdentity, "encrypt", "e", false, "Encrypt the private key with a passphrase")
+	createCmd.Flags().BoolVar(&createInToken, "pkcs11", false, "Generate the key inside the PKCS#11 token given by --pkcs11-module and --pkcs11-token")
+}
+
+func createTokenKey() {
+	config, ok := pkcs11Config()
+	if !ok {
+		log.Error("Missing PKCS#11 module, please provide one with --pkcs11-module. See `sputnik help identity create`")
+		return
+	}
+
+	publicKey, err := pkcs11.GenerateKey(config)
+	if err != nil {
+		log.Errorf("Failed to create the key in the token (%s)", err)
+		return
+	}
+
+	publicKeyPEM, err := keymanager.PublicKeyPEM(publicKey)
+	if err != nil {
+		log.Errorf("%s", err)
+		return
+	}
+	log.Infof("Created the key `%s` in the token. This is the public key for the CloudKit Dashboard:\n%s", config.KeyLabel, publicKeyPEM)
 }
 
 func createECKey() {
-	keyManager := keymanager.New()
+	name := identityName
+	if len(name) == 0 {
+		name = profile
+	}
+	keyManager, err := namedKeyManager(name)
+	if err != nil {
+		log.Errorf("%s", err)
+		return
+	}
+
 	exists, err := keyManager.SigningIdentityExists()
 	if err != nil {
 		log.Errorf("Error in SigningIdentityExists: %s", err)
 	}
 
 	if exists {
-		log.Error("There is an existing identity. You need to remove it with `./sputnik identity remove` before you can create a new one.")
-		if len(keyManager.KeyID()) != 0 {
+		log.Errorf("There is an existing identity in the %s profile. You need to remove it with `./sputnik identity remove` before you can create a new one.", keyManager.Profile())
+		if keyID, err := keyManager.KeyID(); err == nil {
 			// a key ID has been stored
-			log.Infof("The current identity is linked with the following iCloud key ID:\n%s", keyManager.KeyID())
+			log.Infof("The current identity is linked with the following iCloud key ID:\n%s", keyID)
 		} else {
 			log.Infof("This is the current identity:\n%s", keyManager.ECKey())
 		}
 	} else {
-		log.Info("Creating an identity")
-		keyManager.CreateSigningIdentity()
+		log.Infof("Creating an identity in the %s profile", keyManager.Profile())
+		if encryptIdentity {
+			var passphrase []byte
+			passphrase, err = newPassphrase()
+			if err != nil {
+				log.Errorf("A passphrase is required to encrypt the signing identity (%s)", err)
+				return
+			}
+			err = keyManager.CreateEncryptedSigningIdentity(passphrase)
+		} else {
+			err = keyManager.CreateSigningIdentity()
+		}
+		if err != nil {
+			log.Errorf("Failed to create the signing identity (%s)", err)
+			return
+		}
 		log.Info("Done")
 	}
 }
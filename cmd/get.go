@@ -22,7 +22,6 @@ package cmd
 
 import (
 	"github.com/apex/log"
-	"github.com/q231950/sputnik/keymanager"
 	"github.com/q231950/sputnik/requesthandling"
 	"github.com/spf13/cobra"
 )
@@ -39,9 +38,14 @@ This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.WithField("Payload", payload).Info("Attempting to GET...")
-		keyManager := keymanager.New()
-		config := requesthandling.RequestConfig{}
-		requestManager := requesthandling.New(config, &keyManager)
+		keyManager, closeKeyManager, err := requestKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		defer closeKeyManager()
+		config := requestConfig(container)
+		requestManager := requesthandling.New(config, keyManager, requestOptions()...)
 		requestManager.GetRequest("lookup", "{}")
 	},
 }
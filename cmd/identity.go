@@ -21,6 +21,9 @@
 package cmd
 
 import (
+	"crypto/ecdsa"
+	"errors"
+
 	log "github.com/apex/log"
 
 	"github.com/q231950/sputnik/keymanager"
@@ -31,26 +34,48 @@ import (
 var eckeyCmd = &cobra.Command{
 	Use:   "identity",
 	Short: "Show the signing identity",
-	Long:  `Show the signing identity that is used for signing the iCloud requests.`,
+	Long: `Show the signing identity that is used for signing the iCloud requests and where it is read from.
+
+	The private key and the key ID are looked up in this order, the first match wins:
+	#1 the flags --key-file and --key-id
+	#2 the environment variables SPUTNIK_CLOUDKIT_PRIVATE_KEY (PEM or base64 encoded PEM) or SPUTNIK_CLOUDKIT_PRIVATE_KEY_FILE (path to a PEM) and SPUTNIK_CLOUDKIT_KEYID
+	#3 the keys private_key_file and key_id of the config file
+	#4 the profile's credential helper, see 'identity credential-helper'
+	#5 the secrets folder of the profile`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Debug("Attempting to retrieve the current identity...")
-		keyManager := keymanager.New()
-		keyExists, err := keyManager.SigningIdentityExists()
+		keyManager, err := keyManagerChain()
 		if err != nil {
-			log.Errorf("Error in SigningIdentityExists: %s", err)
+			log.Errorf("%s", err)
+			return
+		}
+
+		publicKey, err := keyManager.PublicKey()
+		if errors.Is(err, keymanager.ErrNoIdentity) {
+			log.Error("A signing identity could not be found. A signing identity can be created by `./sputnik identity create`")
+			return
+		} else if err != nil {
+			log.Errorf("The signing identity can't be read (%s)", err)
+			return
 		}
 
-		if keyExists {
-			identity := keyManager.ECKey()
-			log.Debug("The current identity you can create a new server-to-server key with in the iCloud Dashboard:")
-			log.Infof("\n%s", identity)
+		identity, err := keymanager.PublicKeyPEM(publicKey)
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		log.Debug("The current identity you can create a new server-to-server key with in the iCloud Dashboard:")
+		log.Infof("\n%s", identity)
+		logFingerprint(publicKey)
 
-			keyID := keyManager.KeyID()
-			if len(keyID) == 0 {
-				log.Error("No iCloud KeyID specified. Please either provide one by `sputnik keyid store <your KeyID>` or set the environment variable `SPUTNIK_CLOUDKIT_KEYID`.")
-			}
+		_, keyIDErr := keyManager.KeyID()
+		provenance := keyManager.Provenance()
+		log.Infof("The private key is read from the %s", provenance.PrivateKey)
+		if keyIDErr != nil {
+			log.Debugf("%s", keyIDErr)
+			log.Error("No iCloud KeyID specified. Please either provide one by `sputnik keyid store <your KeyID>` or set the environment variable `SPUTNIK_CLOUDKIT_KEYID`.")
 		} else {
-			log.Error("A signing identity could not be found. A signing identity can be created by `./sputnik identity create`")
+			log.Infof("The key ID is read from the %s", provenance.KeyID)
 		}
 	},
 }
@@ -58,3 +83,13 @@ var eckeyCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(eckeyCmd)
 }
+
+// logFingerprint logs the fingerprint of the public key, so that it can be compared with the key in the CloudKit Dashboard
+func logFingerprint(publicKey *ecdsa.PublicKey) {
+	fingerprint, err := keymanager.Fingerprint(publicKey)
+	if err != nil {
+		log.Warnf("The fingerprint of the public key can't be computed (%s)", err)
+		return
+	}
+	log.Infof("Fingerprint: %s", fingerprint)
+}
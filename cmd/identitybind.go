@@ -0,0 +1,139 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// identitybindCmd represents the identity bind command
+var identitybindCmd = &cobra.Command{
+	Use:   "bind",
+	Short: "Binds a container and environment to a profile and key ID",
+	Long: `CloudKit issues a separate key ID per container and environment. Bind tells sputnik which profile and key ID to use for requests to a container:
+
+	./sputnik identity bind --container iCloud.com.some.bundle --environment production --profile production --key-id <key id>
+
+	Without --profile, requests keep the signing identity they would use otherwise, without --key-id they keep its key ID.
+	Requests sent with --profile, --key-file or --key-id ignore the bindings.
+	Bindings are stored in the secrets folder. They can also be listed under the bindings key of ~/.sputnik.yaml, which take precedence:
+
+	bindings:
+	  - container: iCloud.com.some.bundle
+	    environment: production
+	    profile: production
+	    key_id: <key id>
+
+	Use --list to show the stored bindings and --remove to remove the binding of a container and environment.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		secretsFolder, err := secretsDir()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		if listBindings {
+			bindings, err := keymanager.Bindings(secretsFolder)
+			if err != nil {
+				log.Errorf("Failed to read the bindings (%s)", err)
+				return
+			}
+			for _, binding := range bindings {
+				log.WithFields(log.Fields{
+					"environment": binding.Environment,
+					"profile":     binding.Profile,
+					"key id":      binding.KeyID}).Info(binding.ContainerID)
+			}
+			log.Infof("%d bindings in %s", len(bindings), secretsFolder)
+			return
+		}
+
+		if len(bindContainer) == 0 {
+			log.Error("Missing container, please provide one. See `sputnik help identity bind`")
+			return
+		}
+
+		if removeBinding {
+			if err := keymanager.Unbind(secretsFolder, bindContainer, bindEnvironment); err != nil {
+				log.Errorf("Failed to remove the binding (%s)", err)
+				return
+			}
+			log.Infof("Removed the binding of %s in %s", bindContainer, bindEnvironment)
+			return
+		}
+
+		binding := keymanager.Binding{ContainerID: bindContainer, Environment: bindEnvironment, Profile: bindProfile, KeyID: bindKeyID}
+		if err := keymanager.Bind(secretsFolder, binding); err != nil {
+			log.Errorf("Failed to store the binding (%s)", err)
+			return
+		}
+		log.WithFields(log.Fields{
+			"profile": binding.Profile,
+			"key id":  binding.KeyID}).Infof("Bound %s in %s", binding.ContainerID, binding.Environment)
+	},
+}
+
+var bindContainer string
+var bindEnvironment string
+var bindProfile string
+var bindKeyID string
+var listBindings bool
+var removeBinding bool
+
+func init() {
+	eckeyCmd.AddCommand(identitybindCmd)
+	identitybindCmd.Flags().StringVarP(&bindContainer, "container", "c", "", "The CloudKit container to bind, e.g. iCloud.your.bundle.identifier")
+	identitybindCmd.Flags().StringVar(&bindEnvironment, "environment", keymanager.DevelopmentEnvironment, "The CloudKit environment to bind, development or production")
+	// --profile and --key-id shadow the global flags, they describe the binding rather than the identity of this command
+	identitybindCmd.Flags().StringVar(&bindProfile, "profile", "", "The profile requests to the container use")
+	identitybindCmd.Flags().StringVar(&bindKeyID, "key-id", "", "The CloudKit key ID requests to the container use")
+	identitybindCmd.Flags().BoolVarP(&listBindings, "list", "l", false, "List the stored bindings")
+	identitybindCmd.Flags().BoolVar(&removeBinding, "remove", false, "Remove the binding of the container and environment")
+}
+
+// requestKeyManager returns the key manager for sending requests: signingKeyManager, resolved through the bindings of the config file and the secrets folder.
+// Explicit --profile, --key-file and --key-id flags take precedence over bindings. Call the returned function once done, see signingKeyManager.
+func requestKeyManager() (keymanager.KeyManagerV2, func(), error) {
+	keyManager, closeKeyManager, err := signingKeyManager()
+	if err != nil || len(profile) > 0 || len(keyFileFlag) > 0 || len(keyIDFlag) > 0 {
+		return keyManager, closeKeyManager, err
+	}
+
+	bindings := []keymanager.Binding{}
+	if err := viper.UnmarshalKey("bindings", &bindings); err != nil {
+		closeKeyManager()
+		return nil, nil, err
+	}
+	secretsFolder, err := secretsDir()
+	if err != nil {
+		closeKeyManager()
+		return nil, nil, err
+	}
+	resolver, err := keymanager.NewResolver(secretsFolder, keyManager, bindings...)
+	if err != nil {
+		closeKeyManager()
+		return nil, nil, err
+	}
+	resolver.SetPassphraseProvider(passphraseProvider())
+	return resolver, closeKeyManager, nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+)
+
+// identitycredentialhelperCmd represents the identity credential-helper command
+var identitycredentialhelperCmd = &cobra.Command{
+	Use:   "credential-helper [name]",
+	Short: "Configures the credential helper of a profile",
+	Long: `A credential helper keeps the signing identity and the key ID in a vault instead of the secrets folder.
+	The helper <name> is the executable sputnik-credential-<name> on the PATH:
+
+	./sputnik identity credential-helper vault --profile production
+
+	sputnik runs the helper with the action get or sign and writes a JSON request to its standard input, e.g. {"profile": "production"}.
+	For get, the helper answers on its standard output with {"key_id": "...", "private_key": "<PEM>"}
+	or, if it signs itself, with {"key_id": "...", "public_key": "<PEM>"}.
+	For sign, the request holds the base64 encoded SHA-256 digest in "digest" and the helper answers with {"signature": "<base64 ASN.1 signature>"}.
+	A failing helper exits with a non-zero status and describes the problem on its standard error.
+
+	Without a name, the configured helper is shown. Use --unset to stop using the helper.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secretsFolder, err := secretsDir()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		name := profile
+		if len(name) == 0 {
+			active, err := keymanager.ActiveProfile(secretsFolder)
+			if err != nil {
+				log.Errorf("%s", err)
+				return
+			}
+			name = active
+		}
+
+		if unsetCredentialHelper {
+			if err := keymanager.SetCredentialHelper(secretsFolder, name, ""); err != nil {
+				log.Errorf("Failed to unset the credential helper (%s)", err)
+				return
+			}
+			log.Infof("The %s profile no longer uses a credential helper", name)
+			return
+		}
+
+		if len(args) == 0 {
+			helper, err := keymanager.CredentialHelperName(secretsFolder, name)
+			if err != nil {
+				log.Errorf("%s", err)
+			} else if len(helper) == 0 {
+				log.Infof("The %s profile has no credential helper", name)
+			} else {
+				log.Infof("The %s profile uses the credential helper %s%s", name, keymanager.CredentialHelperPrefix, helper)
+			}
+			return
+		}
+
+		if _, err := keymanager.NewCredentialHelper(args[0], name); err != nil {
+			log.Warnf("%s", err)
+		}
+		if err := keymanager.SetCredentialHelper(secretsFolder, name, args[0]); err != nil {
+			log.Errorf("Failed to set the credential helper (%s)", err)
+			return
+		}
+		log.Infof("The %s profile uses the credential helper %s%s", name, keymanager.CredentialHelperPrefix, args[0])
+	},
+}
+
+var unsetCredentialHelper bool
+
+func init() {
+	eckeyCmd.AddCommand(identitycredentialhelperCmd)
+	identitycredentialhelperCmd.Flags().BoolVar(&unsetCredentialHelper, "unset", false, "Stop using the profile's credential helper")
+}
@@ -0,0 +1,62 @@
+// Copyright © 2017 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+// identitydecryptCmd represents the identity decrypt command
+var identitydecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Removes the passphrase from the signing identity",
+	Long: `Decrypts an encrypted private key and stores it unencrypted in the secrets folder.
+
+	The passphrase is taken from --passphrase-file, SPUTNIK_KEY_PASSPHRASE or a prompt.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		encrypted, err := keyManager.IsEncrypted()
+		if err != nil {
+			log.Errorf("Failed to read the signing identity (%s)", err)
+			return
+		} else if !encrypted {
+			log.Warnf("The signing identity of the %s profile is not encrypted.", keyManager.Profile())
+			return
+		}
+
+		err = keyManager.DecryptSigningIdentity()
+		if err != nil {
+			log.Errorf("Failed to decrypt the signing identity (%s)", err)
+		} else {
+			log.Warnf("The signing identity of the %s profile is now stored without encryption.", keyManager.Profile())
+		}
+	},
+}
+
+func init() {
+	eckeyCmd.AddCommand(identitydecryptCmd)
+}
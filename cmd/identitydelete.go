@@ -21,6 +21,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	log "github.com/apex/log"
 	"github.com/q231950/sputnik/keymanager"
 	"github.com/spf13/cobra"
@@ -33,35 +35,59 @@ var identitydeleteCmd = &cobra.Command{
 	Long: `
 	This command is destructive!
 
-	'remove' removes the current signing identity. This makes the key ID in the Cloudkit Dashboard useless. After running this command you should also revoke the key ID in the matching container in your https://icloud.developer.apple.com/dashboard/.`,
+	'remove' moves the current signing identity, and the previous one kept after a rotation, into the trash of the secrets folder. This makes the key ID in the Cloudkit Dashboard useless. After running this command you should also revoke the key ID in the matching container in your https://icloud.developer.apple.com/dashboard/.
+
+	The removal needs to be confirmed, use --yes in scripts. A removed identity can be brought back with ./sputnik identity restore-removed until it is purged with ./sputnik identity purge.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Info("Attempting to remove the current identity...")
-		keyManager := keymanager.New()
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
 		exists, err := keyManager.SigningIdentityExists()
 		if err != nil {
 			log.Errorf("Error in SigningIdentityExists: %s", err)
 		}
-		if exists {
+		if !exists {
+			log.Warn("There is no signing identity to remove.")
+			return
+		}
+
+		question := fmt.Sprintf("Remove the signing identity of the %s profile?", keyManager.Profile())
+		if metadata, err := keyManager.Metadata(); err == nil {
+			question = fmt.Sprintf("Remove the signing identity %s of the %s profile?", metadata.Fingerprint, keyManager.Profile())
+		}
+		if confirm(question) {
 			removeSigningIdentity(&keyManager)
 		} else {
-			log.Warn("There is no signing identity to remove.")
+			log.Warn("The signing identity was not removed. Use --yes to remove it without confirmation.")
 		}
 	},
 }
 
-func removeSigningIdentity(keyManager keymanager.KeyManager) {
-	pub := keyManager.PublicKey()
-	keyID := keyManager.KeyID()
-	err := keyManager.RemoveSigningIdentity()
+func removeSigningIdentity(keyManager keymanager.KeyManagerV2) {
+	fingerprint := "unknown"
+	if publicKey, err := keyManager.PublicKey(); err != nil {
+		log.Warnf("The public key of the signing identity can't be read (%s)", err)
+	} else if fingerprint, err = keymanager.Fingerprint(publicKey); err != nil {
+		log.Warnf("The fingerprint of the public key can't be computed (%s)", err)
+	}
+	keyID, err := keyManager.KeyID()
+	if err != nil {
+		log.Warnf("The key ID of the signing identity can't be read (%s)", err)
+	}
+	err = keyManager.RemoveSigningIdentity()
 	if err != nil {
 		log.Errorf("An error occurred while removing the signing identity (%s)", err)
 	} else {
 		log.Info("Your signing identity has been removed. Make sure to revoke the corresponding KeyID in the Cloudkit Dashboard.")
-		log.Infof("The identity with the following public key was removed:\n%s", pub)
-		log.Infof("The following key ID is now useless (unless you kept a copy of the private key somewhere outside of Sputnik):\n%s", keyID)
+		log.Infof("The identity with the fingerprint %s was removed", fingerprint)
+		log.Infof("The following key ID is now useless unless the identity is restored with `./sputnik identity restore-removed`:\n%s", keyID)
 	}
 }
 
 func init() {
 	eckeyCmd.AddCommand(identitydeleteCmd)
+	identitydeleteCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Remove the signing identity without asking for confirmation")
 }
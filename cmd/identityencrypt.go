@@ -0,0 +1,68 @@
+// Copyright © 2017 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+// identityencryptCmd represents the identity encrypt command
+var identityencryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypts the signing identity with a passphrase",
+	Long: `Encrypts an existing, unencrypted private key in the secrets folder with a passphrase.
+
+	The passphrase is taken from --passphrase-file, SPUTNIK_KEY_PASSPHRASE or a prompt. Every command that signs requests needs the same passphrase afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		encrypted, err := keyManager.IsEncrypted()
+		if err != nil {
+			log.Errorf("Failed to read the signing identity (%s)", err)
+			return
+		} else if encrypted {
+			log.Warnf("The signing identity of the %s profile is already encrypted.", keyManager.Profile())
+			return
+		}
+
+		passphrase, err := newPassphrase()
+		if err != nil {
+			log.Errorf("A passphrase is required to encrypt the signing identity (%s)", err)
+			return
+		}
+
+		err = keyManager.EncryptSigningIdentity(passphrase)
+		if err != nil {
+			log.Errorf("Failed to encrypt the signing identity (%s)", err)
+		} else {
+			log.Infof("The signing identity of the %s profile is now encrypted.", keyManager.Profile())
+		}
+	},
+}
+
+func init() {
+	eckeyCmd.AddCommand(identityencryptCmd)
+}
@@ -0,0 +1,75 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+
+	log "github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+// identityexportCmd represents the identity export command
+var identityexportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the signing identity into a passphrase protected bundle",
+	Long: `Writes the private key, the key ID, the profile name and the creation date of the signing identity into one bundle, encrypted with a passphrase.
+
+	The passphrase is taken from --passphrase-file, SPUTNIK_KEY_PASSPHRASE or a prompt. Restore the bundle with ./sputnik identity restore <bundle>:
+	./sputnik identity export --out sputnik-identity.bundle`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(bundleFile) == 0 {
+			log.Error("Missing bundle file, please provide one with --out")
+			return
+		}
+
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		passphrase, err := newPassphrase()
+		if err != nil {
+			log.Errorf("A passphrase is required to protect the bundle (%s)", err)
+			return
+		}
+
+		bundle, err := keyManager.ExportBundle(passphrase)
+		if err != nil {
+			log.Errorf("Failed to export the signing identity (%s)", err)
+			return
+		}
+
+		if err := ioutil.WriteFile(bundleFile, bundle, 0600); err != nil {
+			log.Errorf("Failed to write the bundle (%s)", err)
+			return
+		}
+		log.Infof("Exported the signing identity of the %s profile to `%s`", keyManager.Profile(), bundleFile)
+	},
+}
+
+var bundleFile string
+
+func init() {
+	eckeyCmd.AddCommand(identityexportCmd)
+	identityexportCmd.Flags().StringVarP(&bundleFile, "out", "o", "", "The file to write the bundle to")
+}
@@ -0,0 +1,74 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+)
+
+// identityfixpermissionsCmd represents the identity fix-permissions command
+var identityfixpermissionsCmd = &cobra.Command{
+	Use:   "fix-permissions",
+	Short: "Restricts the secrets folder to the current user",
+	Long: `Sets the mode of every folder in the secrets folder to 0700 and of every file to 0600, so that other local users can't read the signing identities.
+	Private keys and Key IDs that other users can access are refused until their permissions are fixed.
+	Those still at mode 0644, which earlier versions of sputnik wrote them with, are used with a warning.
+
+	Use --dry-run to only list the files and folders that are accessible to other users.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		secretsFolder, err := secretsDir()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		if dryRunPermissions {
+			problems, err := keymanager.CheckPermissions(secretsFolder)
+			if err != nil {
+				log.Errorf("Failed to check the secrets folder (%s)", err)
+				return
+			}
+			for _, problem := range problems {
+				log.Warnf("%s", problem)
+			}
+			log.Infof("Found %d permission problems in %s", len(problems), secretsFolder)
+			return
+		}
+
+		fixed, err := keymanager.FixPermissions(secretsFolder)
+		for _, problem := range fixed {
+			log.Infof("Fixed: %s", problem)
+		}
+		if err != nil {
+			log.Errorf("Failed to fix the permissions of the secrets folder (%s)", err)
+			return
+		}
+		log.Infof("Fixed %d permission problems in %s", len(fixed), secretsFolder)
+	},
+}
+
+var dryRunPermissions bool
+
+func init() {
+	eckeyCmd.AddCommand(identityfixpermissionsCmd)
+	identityfixpermissionsCmd.Flags().BoolVar(&dryRunPermissions, "dry-run", false, "Only list the permission problems")
+}
@@ -0,0 +1,85 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+
+	log "github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+// identityimportCmd represents the identity import command
+var identityimportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Imports an existing private key as the signing identity",
+	Long: `Imports an existing P-256 private key, e.g. one created with openssl, into the secrets folder of the active profile or the one given by --profile.
+
+	SEC1 and PKCS#8 keys are accepted, PEM or DER encoded. Use --key-id to store the CloudKit key ID in the same step:
+	./sputnik identity import eckey.der --key-id <key ID from the CloudKit Dashboard>
+
+	Use --encrypt to store the imported key encrypted with a passphrase.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			log.Errorf("Failed to read the private key (%s)", err)
+			return
+		}
+
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		var passphrase []byte
+		if encryptImportedIdentity {
+			passphrase, err = newPassphrase()
+			if err != nil {
+				log.Errorf("A passphrase is required to encrypt the signing identity (%s)", err)
+				return
+			}
+		}
+
+		err = keyManager.ImportSigningIdentity(data, passphrase)
+		if err != nil {
+			log.Errorf("Failed to import the signing identity (%s)", err)
+			return
+		}
+		log.Infof("Imported `%s` into the %s profile", args[0], keyManager.Profile())
+
+		if len(keyIDFlag) > 0 {
+			if err := keyManager.StoreKeyID(keyIDFlag); err != nil {
+				log.Errorf("Failed to store the key ID (%s)", err)
+				return
+			}
+			log.Infof("Stored the key ID `%s`", keyIDFlag)
+		}
+	},
+}
+
+var encryptImportedIdentity bool
+
+func init() {
+	eckeyCmd.AddCommand(identityimportCmd)
+	identityimportCmd.Flags().BoolVarP(&encryptImportedIdentity, "encrypt", "e", false, "Encrypt the imported private key with a passphrase")
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+)
+
+// identitylistCmd represents the identity list command
+var identitylistCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the signing identity profiles",
+	Long: `Lists all signing identity profiles in the secrets folder. The active profile is marked with a *.
+
+	Create a new profile with 'identity create --name <profile>' and switch to it with 'identity use <profile>'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		secretsFolder, err := secretsDir()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		profiles, err := keymanager.Profiles(secretsFolder)
+		if err != nil {
+			log.Errorf("Failed to list the profiles (%s)", err)
+			return
+		}
+
+		active, err := keymanager.ActiveProfile(secretsFolder)
+		if err != nil {
+			log.Warnf("Failed to read the active profile (%s)", err)
+		}
+
+		for _, name := range profiles {
+			marker := " "
+			if name == active {
+				marker = "*"
+			}
+
+			keyManager, _ := keymanager.NewWithProfileInSecretsFolder(secretsFolder, name)
+			if exists, _ := keyManager.SigningIdentityExists(); exists {
+				log.Infof("%s %s", marker, name)
+			} else {
+				log.Infof("%s %s (no signing identity)", marker, name)
+			}
+		}
+	},
+}
+
+func init() {
+	eckeyCmd.AddCommand(identitylistCmd)
+}
@@ -0,0 +1,98 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/q231950/sputnik/requesthandling"
+	"github.com/spf13/cobra"
+)
+
+// identitymetadataCmd represents the identity metadata command
+var identitymetadataCmd = &cobra.Command{
+	Use:   "metadata",
+	Short: "Shows or describes the signing identity",
+	Long: `Shows the creation time and fingerprint of the signing identity and the container, environment and note it is described with.
+
+	Use the flags to describe the signing identity, e.g. to tell which key in the CloudKit Dashboard it belongs to:
+	./sputnik identity metadata --container iCloud.com.example.app --environment development --note "CI"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		if cmd.Flags().Changed("container") || cmd.Flags().Changed("environment") || cmd.Flags().Changed("note") {
+			if err := requesthandling.ValidateEnvironment(metadataEnvironment); err != nil {
+				log.Errorf("%s", err)
+				return
+			}
+			current, err := keyManager.Metadata()
+			if err != nil {
+				log.Errorf("The metadata of the signing identity can't be read (%s)", err)
+				return
+			}
+			if cmd.Flags().Changed("container") {
+				current.Container = metadataContainer
+			}
+			if cmd.Flags().Changed("environment") {
+				current.Environment = metadataEnvironment
+			}
+			if cmd.Flags().Changed("note") {
+				current.Note = metadataNote
+			}
+			if err := keyManager.StoreMetadata(current); err != nil {
+				log.Errorf("Failed to store the metadata (%s)", err)
+				return
+			}
+		}
+
+		metadata, err := keyManager.Metadata()
+		if err != nil {
+			log.Errorf("The metadata of the signing identity can't be read (%s)", err)
+			return
+		}
+		logMetadata(keyManager.Profile(), metadata)
+	},
+}
+
+var metadataContainer string
+var metadataEnvironment string
+var metadataNote string
+
+func init() {
+	eckeyCmd.AddCommand(identitymetadataCmd)
+	identitymetadataCmd.Flags().StringVar(&metadataContainer, "container", "", "The CloudKit container the identity is registered for")
+	identitymetadataCmd.Flags().StringVar(&metadataEnvironment, "environment", "", "The CloudKit environment the identity is registered for, development or production")
+	identitymetadataCmd.Flags().StringVar(&metadataNote, "note", "", "A note describing the identity")
+}
+
+func logMetadata(profile string, metadata keymanager.Metadata) {
+	log.WithFields(log.Fields{
+		"profile":     profile,
+		"created":     metadata.Created.Local().Format("2006-01-02 15:04"),
+		"fingerprint": metadata.Fingerprint,
+		"container":   metadata.Container,
+		"environment": metadata.Environment,
+		"note":        metadata.Note}).Info("Signing identity")
+}
@@ -0,0 +1,68 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+// identitypurgeCmd represents the identity purge command
+var identitypurgeCmd = &cobra.Command{
+	Use:   "purge [name]",
+	Short: "Finally deletes removed signing identities",
+	Long: `
+	This command is destructive!
+
+	'purge' overwrites and deletes the removed signing identities in the trash of the profile, or only the named one. Purged identities can't be restored.
+
+	The purge needs to be confirmed, use --yes in scripts.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		name := ""
+		question := "Finally delete every removed signing identity of the " + keyManager.Profile() + " profile?"
+		if len(args) > 0 {
+			name = args[0]
+			question = "Finally delete the removed signing identity " + name + "?"
+		}
+		if !confirm(question) {
+			log.Warn("Nothing was purged. Use --yes to purge without confirmation.")
+			return
+		}
+
+		if err := keyManager.PurgeRemovedIdentity(name); err != nil {
+			log.Errorf("Failed to purge the removed signing identities (%s)", err)
+			return
+		}
+		log.Infof("Purged the removed signing identities of the %s profile", keyManager.Profile())
+	},
+}
+
+func init() {
+	eckeyCmd.AddCommand(identitypurgeCmd)
+	identitypurgeCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Purge without asking for confirmation")
+}
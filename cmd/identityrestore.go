@@ -0,0 +1,88 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+)
+
+// identityrestoreCmd represents the identity restore command
+var identityrestoreCmd = &cobra.Command{
+	Use:   "restore <bundle>",
+	Short: "Restores a signing identity from a bundle",
+	Long: `Validates a bundle written by ./sputnik identity export and installs its private key and key ID.
+
+	The identity is restored into the profile it was exported from, use --profile to restore it into another one.
+	An existing signing identity is never overwritten. Use --encrypt to store the private key encrypted with the bundle's passphrase.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			log.Errorf("Failed to read the bundle (%s)", err)
+			return
+		}
+
+		passphrase, err := passphraseProvider()()
+		if err != nil {
+			log.Errorf("A passphrase is required to open the bundle (%s)", err)
+			return
+		}
+
+		bundle, err := keymanager.ReadBundle(data, passphrase)
+		if err != nil {
+			log.Errorf("Failed to read the bundle (%s)", err)
+			return
+		}
+
+		name := profile
+		if len(name) == 0 {
+			name = bundle.Profile
+		}
+		keyManager, err := namedKeyManager(name)
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		if !encryptRestoredIdentity {
+			passphrase = nil
+		}
+		if err := keyManager.RestoreBundle(bundle, passphrase); err != nil {
+			log.Errorf("Failed to restore the signing identity (%s)", err)
+			return
+		}
+		log.Infof("Restored the signing identity created %s into the %s profile", bundle.Metadata.Created.Format("2006-01-02"), keyManager.Profile())
+		if len(bundle.KeyID) > 0 {
+			log.Infof("The identity is linked with the key ID `%s`", bundle.KeyID)
+		}
+	},
+}
+
+var encryptRestoredIdentity bool
+
+func init() {
+	eckeyCmd.AddCommand(identityrestoreCmd)
+	identityrestoreCmd.Flags().BoolVarP(&encryptRestoredIdentity, "encrypt", "e", false, "Encrypt the restored private key with the bundle's passphrase")
+}
@@ -0,0 +1,75 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+// identityrestoreremovedCmd represents the identity restore-removed command
+var identityrestoreremovedCmd = &cobra.Command{
+	Use:   "restore-removed [name]",
+	Short: "Restores a removed signing identity from the trash",
+	Long: `Moves a signing identity that was removed with ./sputnik identity remove back into place.
+
+	Without a name, the most recently removed identity is restored. Use --list to show the removed identities and their names.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		if listRemoved {
+			removed, err := keyManager.RemovedIdentities()
+			if err != nil {
+				log.Errorf("Failed to read the trash (%s)", err)
+				return
+			}
+			for _, identity := range removed {
+				log.WithFields(log.Fields{
+					"removed":     identity.Removed.Local().Format("2006-01-02 15:04:05"),
+					"fingerprint": identity.Fingerprint}).Info(identity.Name)
+			}
+			log.Infof("%d removed identities in the %s profile", len(removed), keyManager.Profile())
+			return
+		}
+
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if err := keyManager.RestoreRemovedIdentity(name); err != nil {
+			log.Errorf("Failed to restore the signing identity (%s)", err)
+			return
+		}
+		log.Infof("Restored the signing identity of the %s profile", keyManager.Profile())
+	},
+}
+
+var listRemoved bool
+
+func init() {
+	eckeyCmd.AddCommand(identityrestoreremovedCmd)
+	identityrestoreremovedCmd.Flags().BoolVarP(&listRemoved, "list", "l", false, "List the removed identities instead of restoring one")
+}
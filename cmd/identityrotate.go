@@ -0,0 +1,114 @@
+// Copyright © 2016 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// identityrotateCmd represents the identity rotate command
+var identityrotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotates the signing identity without a window where signing is broken",
+	Long: `Rotating the signing identity takes two steps.
+
+	First, a new key is staged next to the active signing identity. Add its public key to the CloudKit Dashboard:
+	./sputnik identity rotate
+
+	Then pass the key ID the dashboard assigned to the new key. The staged key becomes the active one, the replaced key is kept for the grace period:
+	./sputnik identity rotate --new-key-id <new key ID> --grace-period 72h
+
+	The grace period can also be set with the rotation.grace_period config key or SPUTNIK_ROTATION_GRACE_PERIOD.
+	During the grace period, requests that CloudKit rejects, e.g. because the new key ID isn't active yet, are sent again signed with the replaced key.
+	The replaced key also signs while the active key file is missing, but not when the new key fails to decrypt.
+	Expired keys are deleted by the next rotation or the next time the signing identity is read.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+
+		if len(rotateKeyID) > 0 {
+			completeRotation(&keyManager)
+		} else {
+			stageRotation(&keyManager)
+		}
+	},
+}
+
+var rotateKeyID string
+
+func init() {
+	eckeyCmd.AddCommand(identityrotateCmd)
+	identityrotateCmd.Flags().StringVar(&rotateKeyID, "new-key-id", "", "The CloudKit key ID the dashboard assigned to the staged key, completes the rotation")
+	identityrotateCmd.Flags().Duration("grace-period", keymanager.DefaultGracePeriod, "How long the replaced signing identity is kept")
+	viper.BindPFlag("rotation.grace_period", identityrotateCmd.Flags().Lookup("grace-period"))
+}
+
+func stageRotation(keyManager *keymanager.CloudKitKeyManager) {
+	publicKey, err := keyManager.StagedPublicKey()
+	if err == nil {
+		log.Infof("A key is already staged in the %s profile", keyManager.Profile())
+	} else if errors.Is(err, keymanager.ErrNoIdentity) {
+		var passphrase []byte
+		if encrypted, _ := keyManager.IsEncrypted(); encrypted {
+			passphrase, err = newPassphrase()
+			if err != nil {
+				log.Errorf("A passphrase is required to encrypt the staged key (%s)", err)
+				return
+			}
+		}
+
+		publicKey, err = keyManager.StageSigningIdentity(passphrase)
+		if err != nil {
+			log.Errorf("Failed to stage a new key (%s)", err)
+			return
+		}
+		log.Infof("Staged a new key in the %s profile", keyManager.Profile())
+	} else {
+		log.Errorf("Failed to read the staged key (%s)", err)
+		return
+	}
+
+	publicKeyPEM, err := keymanager.PublicKeyPEM(publicKey)
+	if err != nil {
+		log.Errorf("%s", err)
+		return
+	}
+	log.Infof("Add this public key to the CloudKit Dashboard, then complete the rotation with ./sputnik identity rotate --new-key-id <new key ID>:\n%s", publicKeyPEM)
+}
+
+func completeRotation(keyManager *keymanager.CloudKitKeyManager) {
+	gracePeriod := viper.GetDuration("rotation.grace_period")
+	if err := keyManager.CompleteRotation(rotateKeyID, gracePeriod); err != nil {
+		log.Errorf("Failed to complete the rotation (%s)", err)
+		return
+	}
+
+	expires, _ := keyManager.PreviousIdentityExpires()
+	log.Infof("The staged key is now the signing identity of the %s profile. The previous identity is kept until %s", keyManager.Profile(), expires.Local().Format("2006-01-02 15:04"))
+}
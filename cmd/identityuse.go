@@ -0,0 +1,59 @@
+// Copyright © 2017 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	log "github.com/apex/log"
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/spf13/cobra"
+)
+
+// identityuseCmd represents the identity use command
+var identityuseCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Selects the signing identity profile to use",
+	Long: `Makes the given profile the active one. All commands use the active profile unless --profile is given.
+
+	./sputnik identity use production`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Error("`identity use` requires one argument which is the name of the profile to use.")
+			return
+		}
+
+		name := args[0]
+		secretsFolder, err := secretsDir()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		err = keymanager.UseProfile(secretsFolder, name)
+		if err != nil {
+			log.Errorf("Failed to use the %s profile (%s)", name, err)
+		} else {
+			log.Infof("Now using the %s profile", name)
+		}
+	},
+}
+
+func init() {
+	eckeyCmd.AddCommand(identityuseCmd)
+}
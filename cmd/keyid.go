@@ -23,7 +23,6 @@ package cmd
 import (
 	log "github.com/apex/log"
 
-	"github.com/q231950/sputnik/keymanager"
 	"github.com/spf13/cobra"
 )
 
@@ -31,16 +30,29 @@ import (
 var keyidCmd = &cobra.Command{
 	Use:   "keyid",
 	Short: "Show the key ID that is currently in use",
-	Long: `You can provide a Cloudkit key ID by 2 methods
-	#1 use the Sputnik command 'keyid store <your key id>'
-	#2 by setting an environment variable 'SPUTNIK_CLOUDKIT_KEYID'`,
+	Long: `You can provide a Cloudkit key ID by these methods, the first match wins
+	#1 the flag --key-id
+	#2 by setting an environment variable 'SPUTNIK_CLOUDKIT_KEYID'
+	#3 the key key_id of the config file
+	#4 the profile's credential helper, see 'identity credential-helper'
+	#5 use the Sputnik command 'keyid store <your key id>'`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Info("Attempting to retrieve the current key id...")
-		keyManager := keymanager.New()
-		keyID := keyManager.KeyID()
-		if len(keyID) > 0 {
-			log.Infof("The following key id is stored: `%s`", keyID)
+		keyManager, err := keyManagerChain()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		keyID, err := keyManager.KeyID()
+		if err == nil {
+			log.Infof("The following key id is used: `%s`", keyID)
+			log.Infof("It is read from the %s", keyManager.Provenance().KeyID)
+			if publicKey, err := keyManager.PublicKey(); err == nil {
+				log.Info("It is used with the signing identity of the following public key")
+				logFingerprint(publicKey)
+			}
 		} else {
+			log.Debugf("%s", err)
 			log.Error("No iCloud key id specified. Please either provide one by `sputnik keyid store <your KeyID>` or set the environment variable `SPUTNIK_CLOUDKIT_KEYID`.")
 		}
 	},
@@ -0,0 +1,90 @@
+// Copyright © 2017 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/q231950/sputnik/keymanager"
+	"golang.org/x/term"
+)
+
+var passphraseFile string
+
+// passphraseProvider looks for the passphrase of an encrypted signing identity in --passphrase-file and in the environment before prompting for it
+func passphraseProvider() keymanager.PassphraseProvider {
+	providers := append(configuredPassphrases(), promptPassphrase("Passphrase for the signing identity: "))
+	return keymanager.FirstPassphrase(providers...)
+}
+
+// configuredPassphrases returns the providers of a passphrase that was given without prompting. An explicit --passphrase-file wins over the environment.
+func configuredPassphrases() []keymanager.PassphraseProvider {
+	providers := []keymanager.PassphraseProvider{}
+	if len(passphraseFile) > 0 {
+		providers = append(providers, keymanager.PassphraseFromFile(passphraseFile))
+	}
+	return append(providers, keymanager.EnvironmentPassphrase)
+}
+
+// newPassphrase returns the passphrase to encrypt a signing identity with. When prompting, the passphrase needs to be entered twice.
+func newPassphrase() ([]byte, error) {
+	confirmed := func() ([]byte, error) {
+		passphrase, err := promptPassphrase("New passphrase for the signing identity: ")()
+		if err != nil {
+			return nil, err
+		}
+		confirmation, err := promptPassphrase("Repeat the passphrase: ")()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(passphrase, confirmation) {
+			return nil, errors.New("the passphrases don't match")
+		}
+		return passphrase, nil
+	}
+
+	providers := append(configuredPassphrases(), confirmed)
+	return keymanager.FirstPassphrase(providers...)()
+}
+
+// promptPassphrase reads a passphrase from the terminal without echoing it
+func promptPassphrase(prompt string) keymanager.PassphraseProvider {
+	return func() ([]byte, error) {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, keymanager.ErrNoPassphrase
+		}
+
+		fmt.Fprint(os.Stderr, prompt)
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if len(passphrase) == 0 {
+			return nil, keymanager.ErrNoPassphrase
+		}
+		return passphrase, nil
+	}
+}
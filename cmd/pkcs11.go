@@ -0,0 +1,74 @@
+// Copyright © 2017 Martin Kim Dung-Pham <kim@elbedev.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/q231950/sputnik/keymanager/pkcs11"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	RootCmd.PersistentFlags().String("pkcs11-module", "", "the PKCS#11 library of the token that holds the signing key, e.g. /usr/lib/softhsm/libsofthsm2.so")
+	RootCmd.PersistentFlags().String("pkcs11-token", "", "the label of the PKCS#11 token that holds the signing key")
+	RootCmd.PersistentFlags().String("pkcs11-key-label", pkcs11.DefaultKeyLabel, "the label of the signing key in the PKCS#11 token")
+
+	viper.BindPFlag("pkcs11.module", RootCmd.PersistentFlags().Lookup("pkcs11-module"))
+	viper.BindPFlag("pkcs11.token", RootCmd.PersistentFlags().Lookup("pkcs11-token"))
+	viper.BindPFlag("pkcs11.key_label", RootCmd.PersistentFlags().Lookup("pkcs11-key-label"))
+}
+
+// pkcs11Config returns the token configuration from the flags, the config file or the environment (SPUTNIK_PKCS11_MODULE, SPUTNIK_PKCS11_TOKEN, SPUTNIK_PKCS11_KEY_LABEL, SPUTNIK_PKCS11_PIN).
+// It reports false when no PKCS#11 module is configured.
+func pkcs11Config() (pkcs11.Config, bool) {
+	config := pkcs11.Config{
+		Module:     viper.GetString("pkcs11.module"),
+		TokenLabel: viper.GetString("pkcs11.token"),
+		PIN:        viper.GetString("pkcs11.pin"),
+		KeyLabel:   viper.GetString("pkcs11.key_label"),
+	}
+	return config, len(config.Module) > 0
+}
+
+// signingKeyManager returns the key manager for signing requests: the PKCS#11 token when one is configured, keyManagerChain otherwise.
+// The Key ID of a token's key is resolved through keyManagerChain as well. Call the returned function once done, it closes the token's session.
+func signingKeyManager() (keymanager.KeyManagerV2, func(), error) {
+	chain, err := keyManagerChain()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config, ok := pkcs11Config()
+	if !ok {
+		return chain, func() {}, nil
+	}
+
+	keyID, err := chain.KeyID()
+	if err != nil {
+		return nil, nil, err
+	}
+	config.KeyID = keyID
+	token, err := pkcs11.New(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, func() { token.Close() }, nil
+}
@@ -26,7 +26,6 @@ import (
 	"net/http"
 
 	log "github.com/apex/log"
-	"github.com/q231950/sputnik/keymanager"
 	"github.com/q231950/sputnik/requesthandling"
 	"github.com/spf13/cobra"
 )
@@ -44,6 +43,9 @@ var postCmd = &cobra.Command{
 	./sputnik requests post --operation "modify" --payload '<json payload>'
 	./sputnik requests post -o "modify" -p '<json payload>'
 
+	Requests go to the development environment unless --environment production is given.
+	Operations that change production data, like modify, additionally need --allow-production-writes.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.WithFields(log.Fields{
@@ -63,25 +65,26 @@ var postCmd = &cobra.Command{
 			payloadToUse = payload
 		}
 
-		keyManager := keymanager.New()
+		keyManager, closeKeyManager, err := requestKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
+		defer closeKeyManager()
 
 		if container != "" {
-			config := requesthandling.RequestConfig{Version: "1", Database: "public", ContainerID: container}
-			requestManager := requesthandling.New(config, &keyManager)
+			config := requestConfig(container)
+			requestManager := requesthandling.New(config, keyManager, requestOptions()...)
 
-			request, err := requestManager.PostRequest(operation, payloadToUse)
+			resp, err := send(requestManager, func(requestManager requesthandling.CloudkitRequestManager) (*http.Request, error) {
+				return requestManager.PostRequest(operation, payloadToUse)
+			})
 			if err != nil {
 				log.Error(err.Error())
 			} else {
-				client := http.Client{}
-				resp, err := client.Do(request)
-				if err != nil {
-					panic(err)
-				} else {
-					body, _ := ioutil.ReadAll(resp.Body)
-					s, _ := json.MarshalIndent(string(body), "", "    ")
-					log.Info(string(s))
-				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				s, _ := json.MarshalIndent(string(body), "", "    ")
+				log.Info(string(s))
 			}
 		} else {
 			log.Error("Missing container, please provide one. See `sputnik help requests post`")
@@ -23,7 +23,6 @@ package cmd
 import (
 	log "github.com/apex/log"
 
-	"github.com/q231950/sputnik/keymanager"
 	"github.com/spf13/cobra"
 )
 
@@ -35,7 +34,11 @@ var printCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Info("Attempting to print the public key")
 
-		keyManager := keymanager.New()
+		keyManager, err := profileKeyManager()
+		if err != nil {
+			log.Errorf("%s", err)
+			return
+		}
 		exists, err := keyManager.SigningIdentityExists()
 		if err != nil {
 			log.Errorf("Error in SigningIdentityExists: %s", err)
@@ -48,6 +51,9 @@ var printCmd = &cobra.Command{
 
 			log.Infof("Ok done. This is it: \n%s", keyManager.PublicKeyString())
 		}
+		if publicKey, err := keyManager.PublicKey(); err == nil {
+			logFingerprint(publicKey)
+		}
 	},
 }
 
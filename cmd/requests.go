@@ -23,9 +23,12 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 
 	"github.com/apex/log"
+	"github.com/q231950/sputnik/requesthandling"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var payloadFilePath string
@@ -50,6 +53,50 @@ to quickly create a Cobra application.`,
 
 func init() {
 	RootCmd.AddCommand(requestsCmd)
+	requestsCmd.PersistentFlags().String("environment", requesthandling.DevelopmentEnvironment, "The CloudKit environment to send requests to, development or production (see also `SPUTNIK_ENVIRONMENT`)")
+	requestsCmd.PersistentFlags().Bool("allow-production-writes", false, "Allow operations that change production data, e.g. modify")
+	requestsCmd.PersistentFlags().String("endpoint", requesthandling.DefaultBaseURL, "The base URL to send requests to, e.g. a proxy or a local fake server (see also `SPUTNIK_ENDPOINT`)")
+
+	viper.BindPFlag("environment", requestsCmd.PersistentFlags().Lookup("environment"))
+	viper.BindPFlag("allow_production_writes", requestsCmd.PersistentFlags().Lookup("allow-production-writes"))
+	viper.BindPFlag("endpoint", requestsCmd.PersistentFlags().Lookup("endpoint"))
+}
+
+// requestConfig returns the config for requests to the container, in the environment given by --environment or the environment config key
+// and to the base URL given by --endpoint or the endpoint config key
+func requestConfig(containerID string) requesthandling.RequestConfig {
+	config := requesthandling.NewRequestConfigForEnvironment("1", containerID, "public", viper.GetString("environment"))
+	config.AllowProductionWrites = viper.GetBool("allow_production_writes")
+	config.BaseURL = viper.GetString("endpoint")
+	return config
+}
+
+// send sends the request the request manager creates. A request CloudKit rejects is created and sent once more with the fallback identity,
+// e.g. the previous signing identity while the Key ID of a rotation isn't active yet.
+func send(requestManager requesthandling.CloudkitRequestManager, create func(requesthandling.CloudkitRequestManager) (*http.Request, error)) (*http.Response, error) {
+	request, err := create(requestManager)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{}
+	resp, err := client.Do(request)
+	if err != nil || !requesthandling.IsRejected(resp) {
+		return resp, err
+	}
+
+	fallback, err := requestManager.Fallback()
+	if err != nil {
+		log.Debugf("CloudKit rejected the request and there is no identity to retry it with (%s)", err)
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	request, err = create(fallback)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(request)
 }
 
 func payloadFromFile(path string) string {
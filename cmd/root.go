@@ -22,14 +22,19 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
 	log "github.com/apex/log"
 
+	"github.com/q231950/sputnik/keymanager"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
+var profile string
+var keyFileFlag string
+var keyIDFlag string
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -53,6 +58,13 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.sputnik.yaml)")
+	RootCmd.PersistentFlags().StringVar(&passphraseFile, "passphrase-file", "", "a file containing the passphrase of an encrypted signing identity (see also `SPUTNIK_KEY_PASSPHRASE`)")
+	RootCmd.PersistentFlags().StringVar(&profile, "profile", "", "the signing identity profile to use (default is the profile selected by `sputnik identity use`)")
+	RootCmd.PersistentFlags().StringVar(&keyFileFlag, "key-file", "", "a PEM encoded private key to sign with instead of the profile's signing identity")
+	RootCmd.PersistentFlags().StringVar(&keyIDFlag, "key-id", "", "the CloudKit key ID to use instead of the stored one")
+	RootCmd.PersistentFlags().String("secrets-dir", "", "the folder signing identities and key IDs are stored in (default is $HOME/.sputnik/secrets or $XDG_CONFIG_HOME/sputnik/secrets, see also `SPUTNIK_SECRETS_DIR`)")
+
+	viper.BindPFlag("secrets_dir", RootCmd.PersistentFlags().Lookup("secrets-dir"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -63,10 +75,93 @@ func initConfig() {
 
 	viper.SetConfigName(".sputnik") // name of config file (without extension)
 	viper.AddConfigPath("$HOME")    // adding home directory as first search path
-	viper.AutomaticEnv()            // read in environment variables that match
+	viper.SetEnvPrefix("sputnik")   // only consider SPUTNIK_ prefixed environment variables
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		log.Debugf("Using config file: `%s`", viper.ConfigFileUsed())
 	}
 }
+
+// secretsDir returns the secrets folder given by --secrets-dir, the secrets_dir config key or SPUTNIK_SECRETS_DIR.
+// Without any of them, it is keymanager.DefaultSecretsFolder.
+func secretsDir() (string, error) {
+	if folder := viper.GetString("secrets_dir"); len(folder) > 0 {
+		return folder, nil
+	}
+	return keymanager.DefaultSecretsFolder()
+}
+
+// profileKeyManager returns the key manager of the profile given by --profile or, without the flag, of the active profile
+func profileKeyManager() (keymanager.CloudKitKeyManager, error) {
+	return namedKeyManager(profile)
+}
+
+// namedKeyManager returns the key manager of the named profile in the secrets folder given by secretsDir.
+// Without a name, the active profile is used.
+func namedKeyManager(name string) (keymanager.CloudKitKeyManager, error) {
+	secretsFolder, err := secretsDir()
+	if err != nil {
+		return keymanager.CloudKitKeyManager{}, err
+	}
+	keyManager, err := keymanager.NewInSecretsFolder(secretsFolder, name)
+	if err != nil {
+		return keyManager, err
+	}
+	keyManager.SetPassphraseProvider(passphraseProvider())
+	return keyManager, nil
+}
+
+// keyManagerChain resolves the private key and the Key ID from, in order: the --key-file and --key-id flags,
+// the environment, the private_key_file and key_id config keys, the profile's credential helper and the profile given by --profile or the active profile
+func keyManagerChain() (*keymanager.Chain, error) {
+	secretsFolder, err := secretsDir()
+	if err != nil {
+		return nil, err
+	}
+	name := profile
+	if len(name) == 0 {
+		active, err := keymanager.ActiveProfile(secretsFolder)
+		if err != nil {
+			return nil, err
+		}
+		name = active
+	}
+
+	profileManager, err := keymanager.NewWithProfileInSecretsFolder(secretsFolder, name)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase := passphraseProvider()
+	profileManager.SetPassphraseProvider(passphrase)
+	environment := keymanager.NewEnvironmentKeyManager()
+	environment.SetPassphraseProvider(passphrase)
+
+	configName := "config"
+	if len(viper.ConfigFileUsed()) > 0 {
+		configName = "config " + viper.ConfigFileUsed()
+	}
+
+	sources := []keymanager.Source{
+		keymanager.NewFileSource("flags --key-file/--key-id", keyFileFlag, keyIDFlag, passphrase),
+		environment,
+		keymanager.NewFileSource(configName, viper.GetString("private_key_file"), viper.GetString("key_id"), passphrase),
+	}
+
+	helperName, err := keymanager.CredentialHelperName(secretsFolder, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(helperName) > 0 {
+		helper, err := keymanager.NewCredentialHelper(helperName, name)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, helper)
+	}
+
+	return keymanager.NewChain(append(sources, keymanager.NewProfileSource(&profileManager))...), nil
+}
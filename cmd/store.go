@@ -22,7 +22,6 @@ package cmd
 
 import (
 	log "github.com/apex/log"
-	"github.com/q231950/sputnik/keymanager"
 	"github.com/spf13/cobra"
 )
 
@@ -31,12 +30,16 @@ var storeCmd = &cobra.Command{
 	Use:   "store",
 	Short: "Stores the Key ID from the Cloudkit Dashboard.",
 	Long: `After providing the Cloudkit Dashboard with the public key, the keyId is generated.
-	Use this command to store the key ID in Sputnik's secrets folder in ~/.sputnik/secrets/`,
+	Use this command to store the key ID in Sputnik's secrets folder, ~/.sputnik/secrets/ unless --secrets-dir says otherwise`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 1 {
 			keyID := args[0]
-			keyManager := keymanager.New()
-			err := keyManager.StoreKeyID(keyID)
+			keyManager, err := profileKeyManager()
+			if err != nil {
+				log.Errorf("%s", err)
+				return
+			}
+			err = keyManager.StoreKeyID(keyID)
 			if err != nil {
 				log.Errorf("Failed to store kei id (%s)", err)
 			} else {
@@ -0,0 +1,50 @@
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+)
+
+// Adapt turns a KeyManager into a KeyManagerV2.
+//
+// Missing keys and empty Key IDs of the wrapped KeyManager are reported as ErrNoIdentity and ErrNoKeyID.
+func Adapt(keyManager KeyManager) KeyManagerV2 {
+	return adapter{keyManager: keyManager}
+}
+
+// adapter wraps a KeyManager to satisfy KeyManagerV2
+type adapter struct {
+	keyManager KeyManager
+}
+
+func (a adapter) PublicKey() (*ecdsa.PublicKey, error) {
+	publicKey := a.keyManager.PublicKey()
+	if publicKey == nil {
+		return nil, ErrNoIdentity
+	}
+	return publicKey, nil
+}
+
+func (a adapter) Signer() (crypto.Signer, error) {
+	privateKey := a.keyManager.PrivateKey()
+	if privateKey == nil {
+		return nil, ErrNoIdentity
+	}
+	return privateKey, nil
+}
+
+func (a adapter) KeyID() (string, error) {
+	keyID := a.keyManager.KeyID()
+	if len(keyID) == 0 {
+		return "", ErrNoKeyID
+	}
+	return keyID, nil
+}
+
+func (a adapter) RemoveSigningIdentity() error {
+	return a.keyManager.RemoveSigningIdentity()
+}
+
+func (a adapter) StoreKeyID(key string) error {
+	return a.keyManager.StoreKeyID(key)
+}
@@ -0,0 +1,68 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyKeyManager is a KeyManager in the style of implementations that predate KeyManagerV2
+type legacyKeyManager struct {
+	privateKey *ecdsa.PrivateKey
+	keyID      string
+}
+
+func (l legacyKeyManager) PublicKey() *ecdsa.PublicKey {
+	if l.privateKey == nil {
+		return nil
+	}
+	return &l.privateKey.PublicKey
+}
+
+func (l legacyKeyManager) PrivateKey() *ecdsa.PrivateKey {
+	return l.privateKey
+}
+
+func (l legacyKeyManager) KeyID() string {
+	return l.keyID
+}
+
+func (l legacyKeyManager) RemoveSigningIdentity() error {
+	return nil
+}
+
+func (l legacyKeyManager) StoreKeyID(key string) error {
+	return nil
+}
+
+func TestAdaptPassesValuesThrough(t *testing.T) {
+	key, _ := generatePrivateKey()
+	manager := Adapt(legacyKeyManager{privateKey: key, keyID: "abc"})
+
+	signer, err := manager.Signer()
+	assert.Nil(t, err)
+	assert.Equal(t, key, signer)
+
+	publicKey, err := manager.PublicKey()
+	assert.Nil(t, err)
+	assert.Equal(t, &key.PublicKey, publicKey)
+
+	keyID, err := manager.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", keyID)
+}
+
+func TestAdaptReportsMissingValues(t *testing.T) {
+	manager := Adapt(legacyKeyManager{})
+
+	_, err := manager.Signer()
+	assert.True(t, errors.Is(err, ErrNoIdentity), "A nil private key should be reported as ErrNoIdentity")
+
+	_, err = manager.PublicKey()
+	assert.True(t, errors.Is(err, ErrNoIdentity), "A nil public key should be reported as ErrNoIdentity")
+
+	_, err = manager.KeyID()
+	assert.True(t, errors.Is(err, ErrNoKeyID), "An empty key ID should be reported as ErrNoKeyID")
+}
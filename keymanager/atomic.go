@@ -0,0 +1,79 @@
+package keymanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// lockFileName is the file in a secrets folder that cooperating sputnik processes lock before writing to the folder
+const lockFileName = ".lock"
+
+// writeFileAtomic writes the data to a temporary file next to path, syncs it to disk and renames it into place,
+// so that readers see either the old or the new content but never a partially written file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	folder := filepath.Dir(path)
+	file, err := ioutil.TempFile(folder, ".tmp-"+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+	syncFolder(folder)
+	return nil
+}
+
+// renameAtomic renames source to destination and syncs the folder, so that the rename survives a crash
+func renameAtomic(source string, destination string) error {
+	if err := os.Rename(source, destination); err != nil {
+		return err
+	}
+	syncFolder(filepath.Dir(destination))
+	return nil
+}
+
+// syncFolder flushes renames in the folder to disk. Not every platform can sync folders, so failures are ignored.
+func syncFolder(folder string) {
+	if dir, err := os.Open(folder); err == nil {
+		_ = dir.Sync()
+		dir.Close()
+	}
+}
+
+// lock takes the advisory lock of the key manager's secrets folder and returns the function that releases it.
+//
+// Every method that writes to the secrets folder holds the lock, so that concurrent sputnik processes don't interleave their writes.
+// The lock isn't reentrant, methods holding it must only call helpers that don't lock.
+func (c *CloudKitKeyManager) lock() (func(), error) {
+	if len(c.secretsFolder) == 0 {
+		return nil, ErrNoSecretsFolder
+	}
+	return lockFolder(c.SecretsFolder())
+}
+
+// readLock takes the shared lock of the key manager's secrets folder and returns the function that releases it.
+//
+// Readers hold it while reading the private key and the Key ID, so that they never see a pair that is being replaced, e.g. by CompleteRotation.
+// It must not be taken while holding the lock, which would wait for itself.
+func (c *CloudKitKeyManager) readLock() (func(), error) {
+	return lockFolderShared(c.secretsFolder)
+}
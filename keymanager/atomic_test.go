@@ -0,0 +1,52 @@
+package keymanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	_ = os.MkdirAll("./testFiles", 0700)
+
+	assert.Nil(t, writeFileAtomic("./testFiles/keyid.txt", []byte("first"), 0600))
+	assert.Nil(t, writeFileAtomic("./testFiles/keyid.txt", []byte("second"), 0600))
+
+	content, _ := ioutil.ReadFile("./testFiles/keyid.txt")
+	assert.Equal(t, "second", string(content))
+	entries, _ := ioutil.ReadDir("./testFiles")
+	assert.Equal(t, 1, len(entries), "No temporary files should be left behind")
+}
+
+func TestConcurrentWritesAreNeverTorn(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+			assert.Nil(t, manager.CreateSigningIdentity())
+			assert.Nil(t, manager.StoreKeyID(fmt.Sprintf("key id %d", i)))
+		}(i)
+		go func() {
+			defer wg.Done()
+			reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+			_, err := reader.PrivateKey()
+			assert.Nil(t, err, "A reader should never see a partially written signing identity")
+		}()
+	}
+	wg.Wait()
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	keyID, _ := reader.KeyID()
+	assert.Regexp(t, "^key id [0-9]$", keyID)
+}
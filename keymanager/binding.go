@@ -0,0 +1,209 @@
+package keymanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// bindingsFileName is the file in the secrets folder that holds the bindings stored by Bind
+const bindingsFileName = "bindings.json"
+
+const (
+	// DevelopmentEnvironment is CloudKit's development environment
+	DevelopmentEnvironment = "development"
+	// ProductionEnvironment is CloudKit's production environment
+	ProductionEnvironment = "production"
+)
+
+// A Binding ties a CloudKit container and environment to the profile holding its signing identity and to the Key ID CloudKit issued for it.
+//
+// CloudKit issues a separate Key ID per container and environment. An empty Profile keeps the signing identity of the key manager the Binding is resolved for,
+// an empty KeyID keeps its Key ID.
+type Binding struct {
+	ContainerID string `json:"container" mapstructure:"container"`
+	Environment string `json:"environment" mapstructure:"environment"`
+	Profile     string `json:"profile,omitempty" mapstructure:"profile"`
+	KeyID       string `json:"key_id,omitempty" mapstructure:"key_id"`
+}
+
+// Validate checks that the Binding names a container, a CloudKit environment and, if any, a valid profile
+func (b Binding) Validate() error {
+	if len(b.ContainerID) == 0 {
+		return fmt.Errorf("%w: missing container", ErrInvalidBinding)
+	}
+	if b.Environment != DevelopmentEnvironment && b.Environment != ProductionEnvironment {
+		return fmt.Errorf("%w: the environment `%s` is neither %s nor %s", ErrInvalidBinding, b.Environment, DevelopmentEnvironment, ProductionEnvironment)
+	}
+	if len(b.Profile) > 0 {
+		if err := ValidateProfileName(b.Profile); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidBinding, err)
+		}
+	}
+	return nil
+}
+
+func (b Binding) matches(containerID string, environment string) bool {
+	return b.ContainerID == containerID && b.Environment == environment
+}
+
+// Bindings returns the bindings stored in the secrets folder
+func Bindings(secretsFolder string) ([]Binding, error) {
+	data, err := ioutil.ReadFile(bindingsFilePath(secretsFolder))
+	if os.IsNotExist(err) {
+		return []Binding{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	bindings := []Binding{}
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBinding, err)
+	}
+	return bindings, nil
+}
+
+// Bind stores the binding in the secrets folder. It replaces a stored binding of the same container and environment.
+func Bind(secretsFolder string, binding Binding) error {
+	if err := binding.Validate(); err != nil {
+		return err
+	}
+
+	return changeBindings(secretsFolder, func(bindings []Binding) []Binding {
+		for i, stored := range bindings {
+			if stored.matches(binding.ContainerID, binding.Environment) {
+				bindings[i] = binding
+				return bindings
+			}
+		}
+		return append(bindings, binding)
+	})
+}
+
+// Unbind removes the binding of the container and environment from the secrets folder
+func Unbind(secretsFolder string, containerID string, environment string) error {
+	return changeBindings(secretsFolder, func(bindings []Binding) []Binding {
+		kept := []Binding{}
+		for _, stored := range bindings {
+			if !stored.matches(containerID, environment) {
+				kept = append(kept, stored)
+			}
+		}
+		return kept
+	})
+}
+
+func changeBindings(secretsFolder string, change func([]Binding) []Binding) error {
+	if _, err := createSecretsFolder(secretsFolder); err != nil {
+		return err
+	}
+	unlock, err := lockFolder(secretsFolder)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	bindings, err := Bindings(secretsFolder)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(change(bindings), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(bindingsFilePath(secretsFolder), data, secretsFileMode)
+}
+
+func bindingsFilePath(secretsFolder string) string {
+	return filepath.Join(secretsFolder, bindingsFileName)
+}
+
+// Resolver is a KeyManagerV2 that picks the signing identity and Key ID bound to a container and environment, see KeyManagerFor.
+//
+// Used directly, a Resolver behaves like the key manager it was created with. requesthandling.New resolves it for the container of its RequestConfig.
+type Resolver struct {
+	KeyManagerV2
+	secretsFolder string
+	bindings      []Binding
+	passphrase    PassphraseProvider
+}
+
+// NewResolver returns a Resolver for the bindings stored in the secrets folder.
+//
+// The given bindings, e.g. from a config file, take precedence over stored ones. Containers without a binding use the fallback key manager.
+func NewResolver(secretsFolder string, fallback KeyManagerV2, bindings ...Binding) (*Resolver, error) {
+	for _, binding := range bindings {
+		if err := binding.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := Bindings(secretsFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolver{
+		KeyManagerV2:  fallback,
+		secretsFolder: secretsFolder,
+		bindings:      append(append([]Binding{}, bindings...), stored...),
+		passphrase:    EnvironmentPassphrase}, nil
+}
+
+// SetPassphraseProvider sets where the passphrase of encrypted signing identities in bound profiles comes from
+func (r *Resolver) SetPassphraseProvider(provider PassphraseProvider) {
+	r.passphrase = provider
+}
+
+// Binding returns the binding of the container and environment, if there is one
+func (r *Resolver) Binding(containerID string, environment string) (Binding, bool) {
+	for _, binding := range r.bindings {
+		if binding.matches(containerID, environment) {
+			return binding, true
+		}
+	}
+	return Binding{}, false
+}
+
+// KeyManagerFor returns the key manager for requests to the container in the environment.
+//
+// A bound profile supplies the signing identity, a bound Key ID replaces the Key ID. Without a binding, the fallback key manager is returned.
+func (r *Resolver) KeyManagerFor(containerID string, environment string) (KeyManagerV2, error) {
+	binding, ok := r.Binding(containerID, environment)
+	if !ok {
+		return r.KeyManagerV2, nil
+	}
+
+	keyManager := r.KeyManagerV2
+	if len(binding.Profile) > 0 {
+		profileManager, err := NewWithProfileInSecretsFolder(r.secretsFolder, binding.Profile)
+		if err != nil {
+			return nil, err
+		}
+		profileManager.SetPassphraseProvider(r.passphrase)
+		keyManager = &profileManager
+	}
+
+	if len(binding.KeyID) > 0 {
+		keyManager = boundKeyManager{KeyManagerV2: keyManager, keyID: binding.KeyID}
+	}
+	return keyManager, nil
+}
+
+// boundKeyManager signs with the wrapped key manager and uses the Key ID of a Binding
+type boundKeyManager struct {
+	KeyManagerV2
+	keyID string
+}
+
+func (b boundKeyManager) KeyID() (string, error) {
+	return b.keyID, nil
+}
+
+// StoreKeyID refuses to change the Key ID, which belongs to the Binding
+func (b boundKeyManager) StoreKeyID(key string) error {
+	return ErrReadOnly
+}
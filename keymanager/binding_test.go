@@ -0,0 +1,69 @@
+package keymanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindAndUnbind(t *testing.T) {
+	secretsFolder := "./testBindings"
+	defer os.RemoveAll(secretsFolder)
+
+	assert.Nil(t, Bind(secretsFolder, Binding{ContainerID: "iCloud.a", Environment: DevelopmentEnvironment, KeyID: "first"}))
+	assert.Nil(t, Bind(secretsFolder, Binding{ContainerID: "iCloud.a", Environment: ProductionEnvironment, Profile: "production"}))
+	assert.Nil(t, Bind(secretsFolder, Binding{ContainerID: "iCloud.a", Environment: DevelopmentEnvironment, KeyID: "second"}))
+
+	bindings, err := Bindings(secretsFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, []Binding{
+		{ContainerID: "iCloud.a", Environment: DevelopmentEnvironment, KeyID: "second"},
+		{ContainerID: "iCloud.a", Environment: ProductionEnvironment, Profile: "production"},
+	}, bindings, "Binding a container and environment again should replace the stored binding")
+
+	assert.Nil(t, Unbind(secretsFolder, "iCloud.a", DevelopmentEnvironment))
+	bindings, _ = Bindings(secretsFolder)
+	assert.Equal(t, 1, len(bindings))
+}
+
+func TestInvalidBindings(t *testing.T) {
+	for _, binding := range []Binding{
+		{Environment: DevelopmentEnvironment},
+		{ContainerID: "iCloud.a", Environment: "staging"},
+		{ContainerID: "iCloud.a", Environment: DevelopmentEnvironment, Profile: "../other"},
+	} {
+		assert.True(t, errors.Is(binding.Validate(), ErrInvalidBinding), "%v should not be accepted", binding)
+	}
+}
+
+func TestResolverUsesBoundProfileAndKeyID(t *testing.T) {
+	secretsFolder := "./testBindings"
+	defer os.RemoveAll(secretsFolder)
+
+	production, _ := NewWithProfileInSecretsFolder(secretsFolder, "production")
+	assert.Nil(t, production.CreateSigningIdentity())
+	assert.Nil(t, Bind(secretsFolder, Binding{ContainerID: "iCloud.a", Environment: ProductionEnvironment, Profile: "production", KeyID: "stored key id"}))
+
+	fallback := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	resolver, err := NewResolver(secretsFolder, &fallback,
+		Binding{ContainerID: "iCloud.b", Environment: DevelopmentEnvironment, KeyID: "configured key id"})
+	assert.Nil(t, err)
+
+	keyManager, err := resolver.KeyManagerFor("iCloud.a", ProductionEnvironment)
+	assert.Nil(t, err)
+	keyID, _ := keyManager.KeyID()
+	assert.Equal(t, "stored key id", keyID)
+	expected, _ := production.PublicKey()
+	actual, _ := keyManager.PublicKey()
+	assert.Equal(t, expected, actual, "The bound profile should supply the signing identity")
+
+	keyManager, _ = resolver.KeyManagerFor("iCloud.b", DevelopmentEnvironment)
+	keyID, _ = keyManager.KeyID()
+	assert.Equal(t, "configured key id", keyID)
+	assert.True(t, errors.Is(keyManager.StoreKeyID("other"), ErrReadOnly))
+
+	keyManager, _ = resolver.KeyManagerFor("iCloud.a", DevelopmentEnvironment)
+	assert.Equal(t, &fallback, keyManager, "Containers without a binding should use the fallback")
+}
@@ -0,0 +1,182 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// bundleBlockType is the PEM block type of identity bundles written by ExportBundle
+const bundleBlockType = "SPUTNIK IDENTITY BUNDLE"
+
+// bundleVersion is the version of the bundle's content format. Version 1 bundles had a creation time instead of the metadata.
+const bundleVersion = 2
+
+// A Bundle is a backup of a signing identity, as written by ExportBundle and read by ReadBundle
+type Bundle struct {
+	// Profile is the name of the profile the identity was exported from
+	Profile string
+	// KeyID is the CloudKit Key ID of the identity, it may be empty if none was stored
+	KeyID string
+	// Metadata holds the creation time, fingerprint and description of the identity
+	Metadata Metadata
+	// Exported is the time the bundle was written
+	Exported time.Time
+
+	privateKey *ecdsa.PrivateKey
+}
+
+// bundleContent is the encrypted JSON payload of a bundle
+type bundleContent struct {
+	Version    int       `json:"version"`
+	Profile    string    `json:"profile"`
+	KeyID      string    `json:"key_id"`
+	Metadata   Metadata  `json:"metadata"`
+	Exported   time.Time `json:"exported"`
+	PrivateKey []byte    `json:"private_key"`
+}
+
+// bundleContentV1 holds the creation time, which version 1 bundles stored in place of the metadata
+type bundleContentV1 struct {
+	Created time.Time `json:"created"`
+}
+
+// PublicKey returns the public key of the bundled signing identity
+func (b *Bundle) PublicKey() *ecdsa.PublicKey {
+	return &b.privateKey.PublicKey
+}
+
+// ExportBundle writes the signing identity, its Key ID, profile and metadata into a bundle that is encrypted with the given passphrase
+func (c *CloudKitKeyManager) ExportBundle(passphrase []byte) ([]byte, error) {
+	privateKey, err := c.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := c.storedKeyID()
+	if err != nil && !errors.Is(err, ErrNoKeyID) {
+		return nil, err
+	}
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	content := bundleContent{
+		Version:    bundleVersion,
+		Profile:    c.Profile(),
+		KeyID:      strings.TrimSpace(keyID),
+		Metadata:   metadata,
+		Exported:   time.Now().UTC(),
+		PrivateKey: der,
+	}
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := sealWithPassphrase(bundleBlockType, plaintext, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// ReadBundle decrypts and validates a bundle written by ExportBundle
+func ReadBundle(data []byte, passphrase []byte) (*Bundle, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != bundleBlockType {
+		return nil, fmt.Errorf("%w: no %s found", ErrInvalidBundle, bundleBlockType)
+	}
+
+	plaintext, err := openWithPassphrase(block, passphrase)
+	if errors.Is(err, ErrWrongPassphrase) || errors.Is(err, ErrNoPassphrase) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+
+	var content bundleContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	if content.Version != 1 && content.Version != bundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, content.Version)
+	}
+	if err := ValidateProfileName(content.Profile); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+
+	privateKey, err := x509.ParseECPrivateKey(content.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	if err := CheckSigner(privateKey); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+
+	fingerprint, err := Fingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if content.Version == 1 {
+		var v1 bundleContentV1
+		if err := json.Unmarshal(plaintext, &v1); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+		content.Metadata = Metadata{Created: v1.Created, Fingerprint: fingerprint}
+	}
+	if content.Metadata.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("%w: the fingerprint %s doesn't match the private key", ErrInvalidBundle, content.Metadata.Fingerprint)
+	}
+
+	return &Bundle{
+		Profile:    content.Profile,
+		KeyID:      content.KeyID,
+		Metadata:   content.Metadata,
+		Exported:   content.Exported,
+		privateKey: privateKey,
+	}, nil
+}
+
+// RestoreBundle installs the bundled signing identity and its Key ID, encrypting the private key if a passphrase is given.
+// An existing signing identity is never overwritten.
+func (c *CloudKitKeyManager) RestoreBundle(bundle *Bundle, passphrase []byte) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(c.pemFilePath()); err == nil {
+		return fmt.Errorf("%w: %s", ErrIdentityExists, c.pemFilePath())
+	}
+
+	if err := c.writePrivateKey(bundle.privateKey, passphrase); err != nil {
+		return err
+	}
+	if err := c.writeMetadata(bundle.Metadata); err != nil {
+		return err
+	}
+
+	if len(bundle.KeyID) > 0 {
+		return c.writeKeyID(bundle.KeyID)
+	}
+	return nil
+}
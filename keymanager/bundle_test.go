@@ -0,0 +1,85 @@
+package keymanager
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportAndRestoreBundle(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	source, _ := NewWithProfileInSecretsFolder("./fixtures", DefaultProfile)
+	data, err := source.ExportBundle([]byte("secret"))
+	assert.Nil(t, err)
+
+	bundle, err := ReadBundle(data, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultProfile, bundle.Profile)
+	assert.Equal(t, "abc", bundle.KeyID)
+	assert.False(t, bundle.Metadata.Created.IsZero(), "The creation date of the identity should be part of the bundle")
+
+	target, _ := NewWithProfileInSecretsFolder("./testFiles", "restored")
+	assert.Nil(t, target.RestoreBundle(bundle, nil))
+
+	restored, _ := NewWithProfileInSecretsFolder("./testFiles", "restored")
+	expected, _ := source.PrivateKey()
+	privateKey, err := restored.PrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, expected.D, privateKey.D)
+	keyID, _ := restored.KeyID()
+	assert.Equal(t, "abc", keyID)
+}
+
+func TestReadBundleWrongPassphrase(t *testing.T) {
+	source, _ := NewWithProfileInSecretsFolder("./fixtures", DefaultProfile)
+	data, _ := source.ExportBundle([]byte("secret"))
+
+	_, err := ReadBundle(data, []byte("wrong"))
+	assert.True(t, errors.Is(err, ErrWrongPassphrase))
+}
+
+func TestReadBundleRejectsOtherData(t *testing.T) {
+	_, err := ReadBundle([]byte(fixturePEM(t)), []byte("secret"))
+	assert.True(t, errors.Is(err, ErrInvalidBundle), "A plain private key is not a bundle")
+}
+
+func TestReadBundleRejectsOversizedScryptParameters(t *testing.T) {
+	source, _ := NewWithProfileInSecretsFolder("./fixtures", DefaultProfile)
+	data, _ := source.ExportBundle([]byte("secret"))
+
+	block, _ := pem.Decode(data)
+	block.Headers["N"] = strconv.Itoa(1 << 40)
+	_, err := ReadBundle(pem.EncodeToMemory(block), []byte("secret"))
+	assert.True(t, errors.Is(err, ErrInvalidBundle), "Bundles must not make scrypt allocate terabytes")
+}
+
+func TestRestoreBundleKeepsExistingIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	source, _ := NewWithProfileInSecretsFolder("./fixtures", DefaultProfile)
+	data, _ := source.ExportBundle([]byte("secret"))
+	bundle, _ := ReadBundle(data, []byte("secret"))
+
+	target := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = target.CreateSigningIdentity()
+	assert.True(t, errors.Is(target.RestoreBundle(bundle, nil), ErrIdentityExists))
+}
+
+func TestReadVersion1Bundle(t *testing.T) {
+	// written by the first release of `sputnik identity export` from ./fixtures with the passphrase `secret`
+	data, _ := ioutil.ReadFile("./fixtures/bundle_v1.pem")
+
+	bundle, err := ReadBundle(data, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", bundle.KeyID)
+	assert.False(t, bundle.Metadata.Created.IsZero(), "The creation time of version 1 bundles should be kept")
+
+	source, _ := NewWithProfileInSecretsFolder("./fixtures", DefaultProfile)
+	publicKey, _ := source.PublicKey()
+	fingerprint, _ := Fingerprint(publicKey)
+	assert.Equal(t, fingerprint, bundle.Metadata.Fingerprint, "The fingerprint of version 1 bundles should be computed from the key")
+}
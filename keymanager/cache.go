@@ -0,0 +1,80 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"sync"
+)
+
+// keyCache holds the private key and the Key ID a CloudKitKeyManager has read from the secrets folder.
+//
+// It is shared by all copies of a CloudKitKeyManager and is safe for concurrent use. Every reset starts a new generation,
+// in which the private key and the Key ID are read again. Both files are read together, see CloudKitKeyManager.load.
+type keyCache struct {
+	sync.Mutex
+	generation uint64
+	// loaded is true once the files were read in this generation
+	loaded bool
+	// pemBytes is the PEM that was read with the Key ID. It is parsed on first use, so that no passphrase is asked for just to read the Key ID.
+	pemBytes   []byte
+	keyID      string
+	privateKey *ecdsa.PrivateKey
+}
+
+func (k *keyCache) reset() {
+	k.Lock()
+	defer k.Unlock()
+	k.generation++
+	k.loaded = false
+	k.pemBytes = nil
+	k.keyID = ""
+	k.privateKey = nil
+}
+
+func (k *keyCache) storeKeyID(keyID string) {
+	k.Lock()
+	defer k.Unlock()
+	k.generation++
+	k.keyID = keyID
+}
+
+func (k *keyCache) storePrivateKey(privateKey *ecdsa.PrivateKey) {
+	k.Lock()
+	defer k.Unlock()
+	k.generation++
+	k.privateKey = privateKey
+}
+
+// swap replaces the private key and the Key ID at once
+func (k *keyCache) swap(privateKey *ecdsa.PrivateKey, keyID string) {
+	k.Lock()
+	defer k.Unlock()
+	k.generation++
+	k.loaded = true
+	k.pemBytes = nil
+	k.privateKey = privateKey
+	k.keyID = keyID
+}
+
+// state returns the cache of the key manager. Key managers that weren't created by one of the constructors get a cache of their own.
+func (c *CloudKitKeyManager) state() *keyCache {
+	if c.cache == nil {
+		c.cache = &keyCache{}
+	}
+	return c.cache
+}
+
+// Reload drops the cached private key and Key ID, so that they are read again on their next use, e.g. after another process rotated them.
+func (c *CloudKitKeyManager) Reload() {
+	if c.environment != nil {
+		c.environment.Reload()
+	}
+	c.state().reset()
+}
+
+// Generation counts how often the cached private key and Key ID were replaced or dropped, e.g. by Reload or StoreKeyID
+func (c *CloudKitKeyManager) Generation() uint64 {
+	cache := c.state()
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.generation
+}
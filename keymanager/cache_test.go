@@ -0,0 +1,84 @@
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentSigning(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	digest := sha256.Sum256([]byte("message"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(copied CloudKitKeyManager) {
+			defer wg.Done()
+			signer, err := copied.Signer()
+			assert.Nil(t, err)
+			keyID, err := copied.KeyID()
+			assert.Nil(t, err)
+			assert.Equal(t, "abc\n", keyID)
+
+			signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			assert.Nil(t, err)
+			publicKey, _ := copied.PublicKey()
+			assert.True(t, ecdsa.VerifyASN1(publicKey, digest[:], signature))
+		}(manager)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentReload(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := manager.PrivateKey()
+			assert.Nil(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			manager.Reload()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(20), manager.Generation())
+}
+
+func TestReloadReadsChangedKeyID(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.StoreKeyID("first")
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	keyID, _ := reader.KeyID()
+	assert.Equal(t, "first", keyID)
+
+	_ = writer.StoreKeyID("second")
+	keyID, _ = reader.KeyID()
+	assert.Equal(t, "first", keyID, "The Key ID should be cached until the key manager is reloaded")
+
+	reader.Reload()
+	keyID, _ = reader.KeyID()
+	assert.Equal(t, "second", keyID)
+}
+
+func TestCopiesShareTheCache(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	copied := manager
+
+	_ = manager.StoreKeyID("stored")
+	assert.Equal(t, manager.Generation(), copied.Generation())
+}
@@ -0,0 +1,350 @@
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+// A Source supplies the signer and the Key ID to a Chain.
+//
+// A Source that has no signer returns ErrNoIdentity, one without Key ID returns ErrNoKeyID. The Chain then asks the next Source.
+type Source interface {
+	Name() string
+	Signer() (crypto.Signer, error)
+	KeyID() (string, error)
+}
+
+// detailedSource is implemented by sources that can tell in more detail where their values come from
+type detailedSource interface {
+	PrivateKeySource() string
+	KeyIDSource() string
+}
+
+// Provenance tells which Source of a Chain supplied the private key and which one supplied the Key ID
+type Provenance struct {
+	PrivateKey string
+	KeyID      string
+	// Mixed is set when the private key and the Key ID come from different sources. CloudKit rejects the requests unless the Key ID belongs to the private key.
+	Mixed bool
+}
+
+// Chain is a KeyManagerV2 that asks an ordered list of sources for the private key and the Key ID.
+//
+// The first Source that has a value wins. Any error other than ErrNoIdentity or ErrNoKeyID stops the lookup,
+// so that a broken source doesn't silently hand over to the next one.
+// The private key and the Key ID are looked up separately, a warning is logged when they come from different sources, see Provenance.
+type Chain struct {
+	mutex          sync.Mutex
+	sources        []Source
+	provenance     Provenance
+	inMemoryKeyID  string
+	inMemorySigner crypto.Signer
+	signerSource   string
+	keyIDSource    string
+}
+
+// NewChain returns a Chain that asks the given sources in order
+func NewChain(sources ...Source) *Chain {
+	return &Chain{sources: sources}
+}
+
+// Signer returns the signer of the first source that has one
+func (c *Chain) Signer() (crypto.Signer, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.inMemorySigner != nil {
+		return c.inMemorySigner, nil
+	}
+
+	for _, source := range c.sources {
+		signer, err := source.Signer()
+		if errors.Is(err, ErrNoIdentity) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.Name(), err)
+		}
+
+		c.inMemorySigner = signer
+		c.signerSource = source.Name()
+		c.provenance.PrivateKey = source.Name()
+		if detailed, ok := source.(detailedSource); ok {
+			c.provenance.PrivateKey = detailed.PrivateKeySource()
+		}
+		c.checkPair()
+		return signer, nil
+	}
+
+	return nil, fmt.Errorf("%w in any of %s", ErrNoIdentity, c.names())
+}
+
+// PublicKey returns the public key of the first source that has a signer
+func (c *Chain) PublicKey() (*ecdsa.PublicKey, error) {
+	signer, err := c.Signer()
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyOf(signer)
+}
+
+// KeyID returns the Key ID of the first source that has one
+func (c *Chain) KeyID() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.inMemoryKeyID) > 0 {
+		return c.inMemoryKeyID, nil
+	}
+
+	for _, source := range c.sources {
+		keyID, err := source.KeyID()
+		if errors.Is(err, ErrNoKeyID) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("%s: %w", source.Name(), err)
+		}
+
+		c.inMemoryKeyID = keyID
+		c.keyIDSource = source.Name()
+		c.provenance.KeyID = source.Name()
+		if detailed, ok := source.(detailedSource); ok {
+			c.provenance.KeyID = detailed.KeyIDSource()
+		}
+		c.checkPair()
+		return keyID, nil
+	}
+
+	return "", fmt.Errorf("%w in any of %s", ErrNoKeyID, c.names())
+}
+
+// Provenance resolves the private key and the Key ID and tells which sources supplied them.
+// A value that couldn't be resolved has an empty provenance.
+func (c *Chain) Provenance() Provenance {
+	_, _ = c.Signer()
+	_, _ = c.KeyID()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.provenance
+}
+
+// FallbackIdentity passes on to the source that supplied the signer, see CloudKitKeyManager.FallbackIdentity.
+// Sources without a fallback identity, like the flags or the environment, return ErrNoIdentity.
+func (c *Chain) FallbackIdentity() (KeyManagerV2, error) {
+	if _, err := c.Signer(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, source := range c.sources {
+		if source.Name() != c.signerSource {
+			continue
+		}
+		if fallback, ok := source.(interface {
+			FallbackIdentity() (KeyManagerV2, error)
+		}); ok {
+			return fallback.FallbackIdentity()
+		}
+	}
+	return nil, fmt.Errorf("%w: the %s has no previous signing identity", ErrNoIdentity, c.provenance.PrivateKey)
+}
+
+// Reload drops the cached signer and Key ID and reloads the sources that cache them, so that every source is asked again
+func (c *Chain) Reload() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reset()
+
+	for _, source := range c.sources {
+		if reloadable, ok := source.(interface{ Reload() }); ok {
+			reloadable.Reload()
+		}
+	}
+}
+
+// checkPair warns once both values are resolved if they come from different sources, e.g. a --key-file with the Key ID stored in the profile
+func (c *Chain) checkPair() {
+	if len(c.signerSource) == 0 || len(c.keyIDSource) == 0 {
+		return
+	}
+
+	c.provenance.Mixed = c.signerSource != c.keyIDSource
+	if c.provenance.Mixed {
+		log.Warnf("The private key is read from the %s but the Key ID from the %s, CloudKit rejects requests if they don't belong together", c.provenance.PrivateKey, c.provenance.KeyID)
+	}
+}
+
+func (c *Chain) reset() {
+	c.inMemorySigner = nil
+	c.inMemoryKeyID = ""
+	c.signerSource = ""
+	c.keyIDSource = ""
+	c.provenance = Provenance{}
+}
+
+// RemoveSigningIdentity removes the signing identity from the first source that can be changed
+func (c *Chain) RemoveSigningIdentity() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reset()
+
+	return c.firstWritable(func(writable KeyManagerV2) error {
+		return writable.RemoveSigningIdentity()
+	})
+}
+
+// StoreKeyID stores the Key ID in the first source that can be changed
+func (c *Chain) StoreKeyID(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.inMemoryKeyID = ""
+	c.keyIDSource = ""
+	c.provenance.KeyID = ""
+	c.provenance.Mixed = false
+
+	return c.firstWritable(func(writable KeyManagerV2) error {
+		return writable.StoreKeyID(key)
+	})
+}
+
+func (c *Chain) firstWritable(change func(KeyManagerV2) error) error {
+	for _, source := range c.sources {
+		writable, ok := source.(KeyManagerV2)
+		if !ok {
+			continue
+		}
+
+		err := change(writable)
+		if !errors.Is(err, ErrReadOnly) {
+			return err
+		}
+	}
+	return ErrReadOnly
+}
+
+func (c *Chain) names() []string {
+	names := []string{}
+	for _, source := range c.sources {
+		names = append(names, source.Name())
+	}
+	return names
+}
+
+// NewFileSource returns a Source for a private key file and a Key ID given explicitly, e.g. by command line flags or a config file.
+// Empty values are reported as missing.
+func NewFileSource(name string, privateKeyFile string, keyID string, passphrase PassphraseProvider) Source {
+	return fileSource{name: name, privateKeyFile: privateKeyFile, keyID: keyID, passphrase: passphrase}
+}
+
+type fileSource struct {
+	name           string
+	privateKeyFile string
+	keyID          string
+	passphrase     PassphraseProvider
+}
+
+func (f fileSource) Name() string {
+	return f.name
+}
+
+func (f fileSource) PrivateKeySource() string {
+	return fmt.Sprintf("%s (%s)", f.name, f.privateKeyFile)
+}
+
+func (f fileSource) KeyIDSource() string {
+	return f.name
+}
+
+func (f fileSource) Signer() (crypto.Signer, error) {
+	return signerOf(f.privateKey())
+}
+
+func (f fileSource) privateKey() (*ecdsa.PrivateKey, error) {
+	if len(f.privateKeyFile) == 0 {
+		return nil, ErrNoIdentity
+	}
+
+	pemBytes, err := ioutil.ReadFile(f.privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if isEncryptedPrivateKey(pemBytes) {
+		return decryptWith(pemBytes, f.passphrase)
+	}
+	privateKey, err := parsePrivateKey(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIdentity, err)
+	}
+	return privateKey, nil
+}
+
+func (f fileSource) KeyID() (string, error) {
+	if len(f.keyID) == 0 {
+		return "", ErrNoKeyID
+	}
+	return f.keyID, nil
+}
+
+// NewProfileSource returns a Source for the signing identity in the secrets folder of the given CloudKitKeyManager.
+//
+// Unlike the CloudKitKeyManager itself, the Source ignores the environment, which is a Source of its own.
+// Removing the signing identity and storing the Key ID are passed on to the CloudKitKeyManager.
+func NewProfileSource(manager *CloudKitKeyManager) Source {
+	return profileSource{manager: manager}
+}
+
+type profileSource struct {
+	manager *CloudKitKeyManager
+}
+
+func (p profileSource) Name() string {
+	return fmt.Sprintf("profile %s (%s)", p.manager.Profile(), p.manager.secretsFolder)
+}
+
+func (p profileSource) PrivateKeySource() string {
+	return fmt.Sprintf("profile %s (%s)", p.manager.Profile(), p.manager.pemFilePath())
+}
+
+func (p profileSource) KeyIDSource() string {
+	return fmt.Sprintf("profile %s (%s)", p.manager.Profile(), p.manager.keyIDFilePath())
+}
+
+func (p profileSource) Signer() (crypto.Signer, error) {
+	return p.manager.Signer()
+}
+
+func (p profileSource) PublicKey() (*ecdsa.PublicKey, error) {
+	return p.manager.PublicKey()
+}
+
+func (p profileSource) KeyID() (string, error) {
+	if _, err := os.Stat(p.manager.secretsFolder); os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %w", ErrNoKeyID, err)
+	}
+	return p.manager.storedKeyID()
+}
+
+func (p profileSource) FallbackIdentity() (KeyManagerV2, error) {
+	return p.manager.FallbackIdentity()
+}
+
+func (p profileSource) Reload() {
+	p.manager.Reload()
+}
+
+func (p profileSource) RemoveSigningIdentity() error {
+	return p.manager.RemoveSigningIdentity()
+}
+
+func (p profileSource) StoreKeyID(key string) error {
+	return p.manager.StoreKeyID(key)
+}
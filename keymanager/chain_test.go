@@ -0,0 +1,108 @@
+package keymanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainPrefersEarlierSources(t *testing.T) {
+	flags := NewFileSource("flags", "", "flag key id", nil)
+	fixture := fixtureKeyManager()
+	chain := NewChain(flags, NewProfileSource(&fixture))
+
+	keyID, err := chain.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "flag key id", keyID)
+
+	_, err = chain.Signer()
+	assert.Nil(t, err)
+
+	provenance := chain.Provenance()
+	assert.Equal(t, "flags", provenance.KeyID, "The key ID should come from the first source that has one")
+	assert.Equal(t, "profile default (./fixtures/eckey.pem)", provenance.PrivateKey, "The private key should come from the profile since the flags have none")
+	assert.True(t, provenance.Mixed, "A Key ID from another source than the private key should be reported")
+}
+
+func TestChainPairFromOneSource(t *testing.T) {
+	fixture := fixtureKeyManager()
+	chain := NewChain(NewFileSource("flags", "", "", nil), NewProfileSource(&fixture))
+
+	_, _ = chain.Signer()
+	_, _ = chain.KeyID()
+	assert.False(t, chain.Provenance().Mixed, "The private key and the Key ID of the profile belong together")
+}
+
+func TestChainEnvironmentSource(t *testing.T) {
+	t.Setenv(KeyIDEnvironmentVariableName, "env key id")
+	fixture := fixtureKeyManager()
+	chain := NewChain(NewFileSource("flags", "", "", nil), NewEnvironmentKeyManager(), NewProfileSource(&fixture))
+
+	keyID, _ := chain.KeyID()
+	assert.Equal(t, "env key id", keyID)
+	assert.Equal(t, "environment variable SPUTNIK_CLOUDKIT_KEYID", chain.Provenance().KeyID)
+}
+
+func TestChainWithoutValues(t *testing.T) {
+	chain := NewChain(NewFileSource("flags", "", "", nil))
+
+	_, err := chain.Signer()
+	assert.True(t, errors.Is(err, ErrNoIdentity))
+
+	_, err = chain.KeyID()
+	assert.True(t, errors.Is(err, ErrNoKeyID))
+	assert.Equal(t, Provenance{}, chain.Provenance())
+}
+
+func TestChainStopsAtBrokenSource(t *testing.T) {
+	fixture := fixtureKeyManager()
+	chain := NewChain(NewFileSource("flags", "./fixtures/keyid.txt", "", nil), NewProfileSource(&fixture))
+
+	_, err := chain.Signer()
+	assert.True(t, errors.Is(err, ErrInvalidIdentity), "A broken source must not hand over to the next one")
+}
+
+func TestChainStopsAtMissingEnvironmentKeyFile(t *testing.T) {
+	t.Setenv(PrivateKeyEnvironmentVariableName, "")
+	t.Setenv(PrivateKeyFileEnvironmentVariableName, "./fixtures/missing.pem")
+	fixture := fixtureKeyManager()
+	chain := NewChain(NewEnvironmentKeyManager(), NewProfileSource(&fixture))
+
+	_, err := chain.Signer()
+	assert.True(t, errors.Is(err, ErrInvalidIdentity), "A key file named in the environment must not be replaced by the profile's key")
+}
+
+func TestChainFallbackIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	_, _ = manager.StageSigningIdentity(nil)
+	_ = manager.CompleteRotation("new key id", time.Hour)
+
+	chain := NewChain(NewFileSource("flags", "", "", nil), NewProfileSource(&manager))
+	previous, err := chain.FallbackIdentity()
+	assert.Nil(t, err)
+	keyID, _ := previous.KeyID()
+	assert.Equal(t, "old key id", keyID)
+
+	chain = NewChain(NewFileSource("flags", "./fixtures/eckey.pem", "", nil), NewProfileSource(&manager))
+	_, err = chain.FallbackIdentity()
+	assert.True(t, errors.Is(err, ErrNoIdentity), "Only the source that supplied the signer may fall back")
+}
+
+func TestChainStoresKeyIDInWritableSource(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	chain := NewChain(NewFileSource("flags", "", "", nil), NewEnvironmentKeyManager(), NewProfileSource(&manager))
+
+	assert.Nil(t, chain.StoreKeyID("stored"))
+	keyID, _ := manager.KeyID()
+	assert.Equal(t, "stored", keyID)
+}
+
+func TestChainWithoutWritableSource(t *testing.T) {
+	chain := NewChain(NewFileSource("flags", "", "", nil), NewEnvironmentKeyManager())
+	assert.True(t, errors.Is(chain.StoreKeyID("key"), ErrReadOnly))
+}
@@ -0,0 +1,279 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialHelperPrefix is the prefix of credential helper executables: the helper `vault` is the executable `sputnik-credential-vault` on the PATH
+const CredentialHelperPrefix = "sputnik-credential-"
+
+// credentialHelperFileName is the file in a profile's folder that holds the name of the profile's credential helper
+const credentialHelperFileName = "credential-helper"
+
+// credentialHelperTimeout limits how long a credential helper may take to answer
+const credentialHelperTimeout = 30 * time.Second
+
+// ErrCredentialHelper is returned when a credential helper can't be run, fails or gives an unusable answer
+var ErrCredentialHelper = errors.New("credential helper failed")
+
+// CredentialRequest is written as JSON to the standard input of a credential helper.
+//
+// The helper is run with the action as its only argument:
+//   - get: answer with the Key ID and either the PEM encoded private key or, for remote signing, the PEM encoded public key
+//   - sign: answer with the signature of Digest, a base64 encoded SHA-256 hash
+type CredentialRequest struct {
+	Profile string `json:"profile"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// CredentialResponse is read as JSON from the standard output of a credential helper.
+//
+// A helper that fails exits with a non-zero status. What it wrote to its standard error, or to Error, is passed back as the error message.
+type CredentialResponse struct {
+	KeyID      string `json:"key_id,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CredentialHelper is a KeyManagerV2 and a Source of a Chain that asks an external executable for the signing identity and the Key ID.
+//
+// It works like the credential helpers of docker: secrets stay in a vault and never touch the disk. Helpers either hand out the private key
+// or keep it and sign the digests sputnik sends them.
+type CredentialHelper struct {
+	mutex    sync.Mutex
+	name     string
+	path     string
+	profile  string
+	response *CredentialResponse
+	signer   crypto.Signer
+}
+
+// NewCredentialHelper returns the CredentialHelper for the executable `sputnik-credential-<name>` on the PATH. The helper is told the profile it is asked for.
+func NewCredentialHelper(name string, profile string) (*CredentialHelper, error) {
+	path, err := exec.LookPath(CredentialHelperPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCredentialHelper, err)
+	}
+	return &CredentialHelper{name: name, path: path, profile: profile}, nil
+}
+
+// CredentialHelperName returns the name of the credential helper configured for the profile in the secrets folder, or an empty string if there is none
+func CredentialHelperName(secretsFolder string, profile string) (string, error) {
+	data, err := ioutil.ReadFile(credentialHelperFilePath(secretsFolder, profile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// SetCredentialHelper configures the profile in the secrets folder to use the named credential helper. An empty name removes the configuration.
+func SetCredentialHelper(secretsFolder string, profile string, name string) error {
+	if err := ValidateProfileName(profile); err != nil {
+		return err
+	}
+	path := credentialHelperFilePath(secretsFolder, profile)
+	if len(name) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: `%s` is not a helper name", ErrCredentialHelper, name)
+	}
+
+	folder := filepath.Dir(path)
+	if _, err := createSecretsFolder(folder); err != nil {
+		return err
+	}
+	unlock, err := lockFolder(folder)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeFileAtomic(path, []byte(name+"\n"), secretsFileMode)
+}
+
+func credentialHelperFilePath(secretsFolder string, profile string) string {
+	return filepath.Join(ProfileFolder(secretsFolder, profile), credentialHelperFileName)
+}
+
+// Name identifies the CredentialHelper as a Source of a Chain
+func (h *CredentialHelper) Name() string {
+	return fmt.Sprintf("credential helper %s (%s)", h.name, h.path)
+}
+
+// Signer returns the helper's private key or, if the helper signs remotely, a signer that sends digests to the helper
+func (h *CredentialHelper) Signer() (crypto.Signer, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.signer != nil {
+		return h.signer, nil
+	}
+
+	response, err := h.get()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(response.PrivateKey) > 0:
+		privateKey, err := ParsePrivateKey([]byte(response.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCredentialHelper, err)
+		}
+		h.signer = privateKey
+	case len(response.PublicKey) > 0:
+		publicKey, err := parsePublicKey([]byte(response.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCredentialHelper, err)
+		}
+		h.signer = remoteSigner{helper: h, publicKey: publicKey}
+	default:
+		return nil, fmt.Errorf("%w from %s", ErrNoIdentity, h.Name())
+	}
+	return h.signer, nil
+}
+
+// PublicKey returns the public key of the helper's signing identity
+func (h *CredentialHelper) PublicKey() (*ecdsa.PublicKey, error) {
+	signer, err := h.Signer()
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyOf(signer)
+}
+
+// KeyID returns the Key ID the helper hands out
+func (h *CredentialHelper) KeyID() (string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	response, err := h.get()
+	if err != nil {
+		return "", err
+	}
+	if len(response.KeyID) == 0 {
+		return "", fmt.Errorf("%w from %s", ErrNoKeyID, h.Name())
+	}
+	return response.KeyID, nil
+}
+
+// Reload drops the cached answer, so that the helper is asked again
+func (h *CredentialHelper) Reload() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.response = nil
+	h.signer = nil
+}
+
+// RemoveSigningIdentity refuses to change the signing identity, which is managed by the helper
+func (h *CredentialHelper) RemoveSigningIdentity() error {
+	return ErrReadOnly
+}
+
+// StoreKeyID refuses to change the Key ID, which is managed by the helper
+func (h *CredentialHelper) StoreKeyID(key string) error {
+	return ErrReadOnly
+}
+
+// get asks the helper for the signing identity and the Key ID once and caches the answer. The caller holds the mutex.
+func (h *CredentialHelper) get() (*CredentialResponse, error) {
+	if h.response != nil {
+		return h.response, nil
+	}
+
+	response, err := h.run("get", CredentialRequest{Profile: h.profile})
+	if err != nil {
+		return nil, err
+	}
+	h.response = &response
+	return h.response, nil
+}
+
+// run runs the helper with the action, writes the request to its standard input and reads the response from its standard output
+func (h *CredentialHelper) run(action string, request CredentialRequest) (CredentialResponse, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return CredentialResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, h.path, action)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	runErr := command.Run()
+
+	response := CredentialResponse{}
+	decodeErr := json.Unmarshal(stdout.Bytes(), &response)
+	if runErr != nil {
+		message := strings.TrimSpace(response.Error)
+		if len(message) == 0 {
+			message = strings.TrimSpace(stderr.String())
+		}
+		if len(message) == 0 {
+			message = runErr.Error()
+		}
+		return CredentialResponse{}, fmt.Errorf("%w: %s %s: %s", ErrCredentialHelper, h.Name(), action, message)
+	}
+	if decodeErr != nil {
+		return CredentialResponse{}, fmt.Errorf("%w: %s %s: %w", ErrCredentialHelper, h.Name(), action, decodeErr)
+	}
+	if len(response.Error) > 0 {
+		return CredentialResponse{}, fmt.Errorf("%w: %s %s: %s", ErrCredentialHelper, h.Name(), action, response.Error)
+	}
+	return response, nil
+}
+
+// remoteSigner is the crypto.Signer of a credential helper that keeps its private key and signs digests itself
+type remoteSigner struct {
+	helper    *CredentialHelper
+	publicKey *ecdsa.PublicKey
+}
+
+func (r remoteSigner) Public() crypto.PublicKey {
+	return r.publicKey
+}
+
+func (r remoteSigner) Sign(random io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("%w: credential helpers only sign SHA-256 digests", ErrCredentialHelper)
+	}
+
+	response, err := r.helper.run("sign", CredentialRequest{Profile: r.helper.profile, Digest: base64.StdEncoding.EncodeToString(digest)})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(response.Signature)
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("%w: %s sign: the answer holds no base64 encoded signature", ErrCredentialHelper, r.helper.Name())
+	}
+	if !ecdsa.VerifyASN1(r.publicKey, digest, signature) {
+		return nil, fmt.Errorf("%w: %s sign: the signature doesn't match the public key", ErrCredentialHelper, r.helper.Name())
+	}
+	return signature, nil
+}
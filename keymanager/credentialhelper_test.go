@@ -0,0 +1,135 @@
+//go:build unix
+
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const helpersFolder = "./testHelpers"
+
+// writeStubHelper writes the helper `sputnik-credential-<name>`, which stores its requests next to itself and answers every action with the given responses
+func writeStubHelper(t *testing.T, name string, responses map[string]CredentialResponse, exitCode int) {
+	assert.Nil(t, os.MkdirAll(helpersFolder, 0700))
+	script := "#!/bin/sh\ncat > \"$0.$1.request\"\ncase \"$1\" in\n"
+	for action, response := range responses {
+		output, _ := json.Marshal(response)
+		script += fmt.Sprintf("%s) cat <<'JSON'\n%s\nJSON\n;;\n", action, output)
+	}
+	script += fmt.Sprintf("esac\necho 'vault is sealed' >&2\nexit %d\n", exitCode)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(helpersFolder, CredentialHelperPrefix+name), []byte(script), 0700))
+
+	folder, _ := filepath.Abs(helpersFolder)
+	t.Setenv("PATH", folder+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCredentialHelperPrivateKey(t *testing.T) {
+	defer os.RemoveAll(helpersFolder)
+	pemBytes, _ := ioutil.ReadFile("./fixtures/eckey.pem")
+	writeStubHelper(t, "stub", map[string]CredentialResponse{"get": {KeyID: "vault key id", PrivateKey: string(pemBytes)}}, 0)
+
+	helper, err := NewCredentialHelper("stub", "staging")
+	assert.Nil(t, err)
+	keyID, err := helper.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "vault key id", keyID)
+
+	publicKey, err := helper.PublicKey()
+	assert.Nil(t, err)
+	expected, _ := ParsePrivateKey(pemBytes)
+	assert.Equal(t, &expected.PublicKey, publicKey)
+
+	request, _ := ioutil.ReadFile(filepath.Join(helpersFolder, CredentialHelperPrefix+"stub.get.request"))
+	assert.JSONEq(t, `{"profile":"staging"}`, string(request), "The helper should be told the profile")
+	assert.True(t, errors.Is(helper.StoreKeyID("other"), ErrReadOnly))
+}
+
+func TestCredentialHelperRemoteSigning(t *testing.T) {
+	defer os.RemoveAll(helpersFolder)
+	pemBytes, _ := ioutil.ReadFile("./fixtures/eckey.pem")
+	privateKey, _ := ParsePrivateKey(pemBytes)
+	publicKeyPEM, _ := PublicKeyPEM(&privateKey.PublicKey)
+	digest := sha256.Sum256([]byte("message"))
+	signature, _ := privateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	writeStubHelper(t, "remote", map[string]CredentialResponse{
+		"get":  {KeyID: "vault key id", PublicKey: publicKeyPEM},
+		"sign": {Signature: base64.StdEncoding.EncodeToString(signature)},
+	}, 0)
+
+	helper, _ := NewCredentialHelper("remote", DefaultProfile)
+	signer, err := helper.Signer()
+	assert.Nil(t, err)
+	actual, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.Nil(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], actual))
+
+	request, _ := ioutil.ReadFile(filepath.Join(helpersFolder, CredentialHelperPrefix+"remote.sign.request"))
+	assert.True(t, strings.Contains(string(request), base64.StdEncoding.EncodeToString(digest[:])), "The helper should be sent the digest")
+
+	other := sha256.Sum256([]byte("other message"))
+	_, err = signer.Sign(rand.Reader, other[:], crypto.SHA256)
+	assert.True(t, errors.Is(err, ErrCredentialHelper), "A signature that doesn't match the digest should be rejected")
+}
+
+func TestCredentialHelperFailure(t *testing.T) {
+	defer os.RemoveAll(helpersFolder)
+	writeStubHelper(t, "failing", map[string]CredentialResponse{}, 1)
+
+	helper, _ := NewCredentialHelper("failing", DefaultProfile)
+	_, err := helper.KeyID()
+	assert.True(t, errors.Is(err, ErrCredentialHelper))
+	assert.True(t, strings.Contains(err.Error(), "vault is sealed"), "The helper's message should be passed back")
+
+	_, err = helper.Signer()
+	assert.True(t, errors.Is(err, ErrCredentialHelper))
+}
+
+func TestMissingCredentialHelper(t *testing.T) {
+	_, err := NewCredentialHelper("missing", DefaultProfile)
+	assert.True(t, errors.Is(err, ErrCredentialHelper))
+}
+
+func TestCredentialHelperInChain(t *testing.T) {
+	defer os.RemoveAll(helpersFolder)
+	writeStubHelper(t, "keyid", map[string]CredentialResponse{"get": {KeyID: "vault key id"}}, 0)
+
+	helper, _ := NewCredentialHelper("keyid", DefaultProfile)
+	profile := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	chain := NewChain(helper, NewProfileSource(&profile))
+
+	keyID, err := chain.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "vault key id", keyID)
+	_, err = chain.Signer()
+	assert.Nil(t, err, "A helper without a private key should leave the signing identity to the next source")
+	assert.True(t, strings.HasPrefix(chain.Provenance().PrivateKey, "profile"))
+}
+
+func TestSetCredentialHelper(t *testing.T) {
+	secretsFolder := "./testProfiles"
+	defer os.RemoveAll(secretsFolder)
+
+	assert.Nil(t, SetCredentialHelper(secretsFolder, "staging", "vault"))
+	name, err := CredentialHelperName(secretsFolder, "staging")
+	assert.Nil(t, err)
+	assert.Equal(t, "vault", name)
+
+	assert.Nil(t, SetCredentialHelper(secretsFolder, "staging", ""))
+	name, _ = CredentialHelperName(secretsFolder, "staging")
+	assert.Equal(t, "", name)
+	assert.True(t, errors.Is(SetCredentialHelper(secretsFolder, "staging", "../evil"), ErrCredentialHelper))
+}
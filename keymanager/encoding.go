@@ -0,0 +1,148 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	// ecPrivateKeyBlockType is the PEM block type of SEC1 encoded EC private keys, as written by `openssl ecparam -genkey`
+	ecPrivateKeyBlockType = "EC PRIVATE KEY"
+	// pkcs8PrivateKeyBlockType is the PEM block type of PKCS#8 encoded private keys
+	pkcs8PrivateKeyBlockType = "PRIVATE KEY"
+	// publicKeyBlockType is the PEM block type of PKIX encoded public keys
+	publicKeyBlockType = "PUBLIC KEY"
+	// ecParametersBlockType is the PEM block type of the curve parameters `openssl ecparam -genkey` writes in front of the key
+	ecParametersBlockType = "EC PARAMETERS"
+)
+
+// generatePrivateKey creates a new P-256 (prime256v1) private key, the only curve CloudKit accepts
+func generatePrivateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// encodePrivateKey encodes the given key as SEC1 PEM, the format `openssl ecparam -genkey -noout` produces
+func encodePrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: ecPrivateKeyBlockType, Bytes: der}), nil
+}
+
+// encodePublicKey encodes the given key as PKIX PEM, the format the CloudKit Dashboard expects
+func encodePublicKey(key *ecdsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: publicKeyBlockType, Bytes: der}), nil
+}
+
+// decodePrivateKeyBlock returns the first PEM block that isn't an EC PARAMETERS block, or nil if there is none
+func decodePrivateKeyBlock(pemBytes []byte) *pem.Block {
+	for {
+		block, rest := pem.Decode(pemBytes)
+		if block == nil || block.Type != ecParametersBlockType {
+			return block
+		}
+		pemBytes = rest
+	}
+}
+
+// parsePrivateKey reads an EC private key from SEC1 or PKCS#8 PEM
+func parsePrivateKey(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	block := decodePrivateKeyBlock(pemBytes)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the private key")
+	}
+
+	switch block.Type {
+	case ecPrivateKeyBlockType:
+		return x509.ParseECPrivateKey(block.Bytes)
+	case pkcs8PrivateKeyBlockType:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: the PKCS#8 private key is a %T", ErrUnsupportedKey, key)
+		}
+		return ecKey, nil
+	case encryptedPrivateKeyBlockType:
+		return nil, ErrNoPassphrase
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type `%s`", block.Type)
+	}
+}
+
+// ParsePrivateKey reads a P-256 private key from SEC1 PEM, PKCS#8 PEM, SEC1 DER or PKCS#8 DER, e.g. as written by openssl or Xcode tooling.
+// Keys on other curves and other kinds of keys are rejected with ErrUnsupportedKey.
+func ParsePrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	var privateKey *ecdsa.PrivateKey
+	var err error
+	if block := decodePrivateKeyBlock(data); block != nil {
+		privateKey, err = parsePrivateKey(data)
+	} else {
+		privateKey, err = parseDERPrivateKey(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckSigner(privateKey); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// parseDERPrivateKey reads an EC private key from SEC1 or PKCS#8 DER
+func parseDERPrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	if privateKey, err := x509.ParseECPrivateKey(der); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("the data is neither a PEM nor a SEC1 or PKCS#8 DER encoded private key")
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: the PKCS#8 private key is a %T", ErrUnsupportedKey, key)
+	}
+	return ecKey, nil
+}
+
+// parsePublicKey reads a P-256 public key from PKIX PEM
+func parsePublicKey(pemBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != publicKeyBlockType {
+		return nil, errors.New("failed to decode PEM block containing the public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: the public key is a %T", ErrUnsupportedKey, key)
+	}
+	return ecKey, nil
+}
+
+// PublicKeyPEM returns the PKIX PEM encoding of the given public key, ready to be pasted into the CloudKit Dashboard
+func PublicKeyPEM(key *ecdsa.PublicKey) (string, error) {
+	pemBytes, err := encodePublicKey(key)
+	return string(pemBytes), err
+}
@@ -0,0 +1,60 @@
+package keymanager
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePrivateKeyUsesP256(t *testing.T) {
+	key, err := generatePrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, elliptic.P256(), key.Curve, "CloudKit only accepts prime256v1 keys")
+}
+
+func TestEncodedPrivateKeyRoundTrip(t *testing.T) {
+	key, _ := generatePrivateKey()
+	pemBytes, err := encodePrivateKey(key)
+	assert.Nil(t, err)
+
+	block, _ := pem.Decode(pemBytes)
+	assert.Equal(t, "EC PRIVATE KEY", block.Type, "Private keys should be stored in the format openssl writes")
+
+	parsed, err := parsePrivateKey(pemBytes)
+	assert.Nil(t, err)
+	assert.Equal(t, key.D, parsed.D)
+}
+
+func TestParsePKCS8PrivateKey(t *testing.T) {
+	fixture, _ := ioutil.ReadFile("./fixtures/eckey.pem")
+	key, _ := parsePrivateKey(fixture)
+
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	parsed, err := parsePrivateKey(pkcs8)
+	assert.Nil(t, err)
+	assert.Equal(t, key.D, parsed.D, "PKCS#8 encoded keys should be read just like SEC1 encoded ones")
+}
+
+func TestParsePrivateKeyRejectsGarbage(t *testing.T) {
+	_, err := parsePrivateKey([]byte("not a pem"))
+	assert.NotNil(t, err)
+}
+
+func TestParseOpenSSLECParamKey(t *testing.T) {
+	// written by `openssl ecparam -name prime256v1 -genkey`, which puts an EC PARAMETERS block in front of the key
+	fixture, _ := ioutil.ReadFile("./fixtures/openssl_ecparam.pem")
+
+	key, err := parsePrivateKey(fixture)
+	assert.Nil(t, err)
+	assert.Equal(t, elliptic.P256(), key.Curve)
+
+	imported, err := ParsePrivateKey(fixture)
+	assert.Nil(t, err)
+	assert.Equal(t, key.D, imported.D)
+}
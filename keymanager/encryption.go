@@ -0,0 +1,215 @@
+package keymanager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnvironmentVariableName is the environment variable that holds the passphrase of an encrypted signing identity
+const PassphraseEnvironmentVariableName = string("SPUTNIK_KEY_PASSPHRASE")
+
+// PassphraseFileEnvironmentVariableName is the environment variable that holds the path to a file containing the passphrase of an encrypted signing identity
+const PassphraseFileEnvironmentVariableName = string("SPUTNIK_KEY_PASSPHRASE_FILE")
+
+// encryptedPrivateKeyBlockType is the PEM block type of private keys encrypted by sputnik
+const encryptedPrivateKeyBlockType = "SPUTNIK ENCRYPTED PRIVATE KEY"
+
+// scrypt parameters for deriving the AES-256 key from the passphrase. They are stored in the PEM headers, so they can be lowered without breaking existing keys.
+// Headers asking for more than these are refused, a crafted bundle must not make scrypt allocate more memory than sputnik itself would.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLength   = 16
+)
+
+// A PassphraseProvider returns the passphrase for decrypting an encrypted signing identity.
+//
+// Providers that have no passphrase to offer return ErrNoPassphrase.
+type PassphraseProvider func() ([]byte, error)
+
+// EnvironmentPassphrase reads the passphrase from SPUTNIK_KEY_PASSPHRASE or, if that isn't set, from the file SPUTNIK_KEY_PASSPHRASE_FILE points to
+func EnvironmentPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(PassphraseEnvironmentVariableName); len(passphrase) > 0 {
+		return []byte(passphrase), nil
+	}
+
+	if path := os.Getenv(PassphraseFileEnvironmentVariableName); len(path) > 0 {
+		return PassphraseFromFile(path)()
+	}
+
+	return nil, ErrNoPassphrase
+}
+
+// PassphraseFromFile returns a PassphraseProvider that reads the passphrase from the given file. A trailing line break is not part of the passphrase.
+func PassphraseFromFile(path string) PassphraseProvider {
+	return func() ([]byte, error) {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		passphrase := strings.TrimRight(string(bytes), "\r\n")
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("%w: %s is empty", ErrNoPassphrase, path)
+		}
+		return []byte(passphrase), nil
+	}
+}
+
+// FirstPassphrase returns a PassphraseProvider that asks the given providers in order and returns the first passphrase found
+func FirstPassphrase(providers ...PassphraseProvider) PassphraseProvider {
+	return func() ([]byte, error) {
+		for _, provider := range providers {
+			passphrase, err := provider()
+			if err == nil {
+				return passphrase, nil
+			} else if !errors.Is(err, ErrNoPassphrase) {
+				return nil, err
+			}
+		}
+		return nil, ErrNoPassphrase
+	}
+}
+
+// encryptPrivateKey encrypts the SEC1 encoding of the given key with AES-256-GCM, using a key derived from the passphrase with scrypt
+func encryptPrivateKey(key *ecdsa.PrivateKey, passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := sealWithPassphrase(encryptedPrivateKeyBlockType, der, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// decryptPrivateKey reverses encryptPrivateKey
+func decryptPrivateKey(block *pem.Block, passphrase []byte) (*ecdsa.PrivateKey, error) {
+	der, err := openWithPassphrase(block, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// sealWithPassphrase encrypts the plaintext with AES-256-GCM into a PEM block of the given type, using a key derived from the passphrase with scrypt.
+// The scrypt parameters, the salt and the nonce are stored in the block's headers, the block type is authenticated as additional data.
+func sealWithPassphrase(blockType string, plaintext []byte, passphrase []byte) (*pem.Block, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrNoPassphrase
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{
+		Type: blockType,
+		Headers: map[string]string{
+			"KDF":    "scrypt",
+			"N":      strconv.Itoa(scryptN),
+			"R":      strconv.Itoa(scryptR),
+			"P":      strconv.Itoa(scryptP),
+			"Salt":   base64.StdEncoding.EncodeToString(salt),
+			"Cipher": "AES-256-GCM",
+			"Nonce":  base64.StdEncoding.EncodeToString(nonce),
+		},
+		Bytes: aead.Seal(nil, nonce, plaintext, []byte(blockType)),
+	}, nil
+}
+
+// openWithPassphrase reverses sealWithPassphrase
+func openWithPassphrase(block *pem.Block, passphrase []byte) ([]byte, error) {
+	if block.Headers["KDF"] != "scrypt" || block.Headers["Cipher"] != "AES-256-GCM" {
+		return nil, fmt.Errorf("unsupported encryption `%s`/`%s`", block.Headers["KDF"], block.Headers["Cipher"])
+	}
+
+	n, errN := strconv.Atoi(block.Headers["N"])
+	r, errR := strconv.Atoi(block.Headers["R"])
+	p, errP := strconv.Atoi(block.Headers["P"])
+	salt, errSalt := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	nonce, errNonce := base64.StdEncoding.DecodeString(block.Headers["Nonce"])
+	for _, err := range []error{errN, errR, errP, errSalt, errNonce} {
+		if err != nil {
+			return nil, fmt.Errorf("malformed encryption header: %w", err)
+		}
+	}
+
+	if n > scryptN || r > scryptR || p > scryptP {
+		return nil, fmt.Errorf("unsupported scrypt parameters N=%d R=%d P=%d, at most N=%d R=%d P=%d are allowed", n, r, p, scryptN, scryptR, scryptP)
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, n, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("malformed encryption header: nonce has %d bytes", len(nonce))
+	}
+
+	plaintext, err := aead.Open(nil, nonce, block.Bytes, []byte(block.Type))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// decryptWith decrypts the given PEM with the passphrase from the given provider
+func decryptWith(pemBytes []byte, provider PassphraseProvider) (*ecdsa.PrivateKey, error) {
+	if provider == nil {
+		return nil, ErrNoPassphrase
+	}
+	passphrase, err := provider()
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptPrivateKey(decodePrivateKeyBlock(pemBytes), passphrase)
+}
+
+// isEncryptedPrivateKey tells whether the given PEM holds a private key encrypted by sputnik
+func isEncryptedPrivateKey(pemBytes []byte) bool {
+	block := decodePrivateKeyBlock(pemBytes)
+	return block != nil && block.Type == encryptedPrivateKeyBlockType
+}
+
+func passphraseCipher(passphrase []byte, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
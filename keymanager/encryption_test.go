@@ -0,0 +1,95 @@
+package keymanager
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedPrivateKeyRoundTrip(t *testing.T) {
+	key, _ := generatePrivateKey()
+	pemBytes, err := encryptPrivateKey(key, []byte("secret"))
+	assert.Nil(t, err)
+	assert.True(t, isEncryptedPrivateKey(pemBytes))
+	assert.False(t, strings.Contains(string(pemBytes), "EC PRIVATE KEY"), "The key must not be stored in plain text")
+
+	block, _ := pem.Decode(pemBytes)
+	decrypted, err := decryptPrivateKey(block, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, key.D, decrypted.D)
+}
+
+func TestDecryptPrivateKeyWithWrongPassphrase(t *testing.T) {
+	key, _ := generatePrivateKey()
+	pemBytes, _ := encryptPrivateKey(key, []byte("secret"))
+
+	block, _ := pem.Decode(pemBytes)
+	_, err := decryptPrivateKey(block, []byte("guess"))
+	assert.True(t, errors.Is(err, ErrWrongPassphrase))
+}
+
+func TestEncryptedSigningIdentityWithPassphraseFromEnvironment(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.Nil(t, manager.CreateEncryptedSigningIdentity([]byte("secret")))
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := reader.PrivateKey()
+	assert.True(t, errors.Is(err, ErrNoPassphrase), "An encrypted identity can't be read without a passphrase")
+
+	t.Setenv(PassphraseEnvironmentVariableName, "secret")
+	privateKey, err := reader.PrivateKey()
+	assert.Nil(t, err)
+	expected, _ := manager.PrivateKey()
+	assert.Equal(t, expected.D, privateKey.D)
+}
+
+func TestEncryptedSigningIdentityWithPassphraseFile(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.Nil(t, manager.CreateEncryptedSigningIdentity([]byte("secret")))
+	_ = ioutil.WriteFile("./testFiles/passphrase", []byte("secret\n"), 0600)
+
+	t.Setenv(PassphraseFileEnvironmentVariableName, "./testFiles/passphrase")
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := reader.PrivateKey()
+	assert.Nil(t, err, "The passphrase file's trailing line break should not be part of the passphrase")
+}
+
+func TestFirstPassphrase(t *testing.T) {
+	none := func() ([]byte, error) { return nil, ErrNoPassphrase }
+	some := func() ([]byte, error) { return []byte("secret"), nil }
+
+	passphrase, err := FirstPassphrase(none, some)()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), passphrase)
+
+	_, err = FirstPassphrase(none)()
+	assert.True(t, errors.Is(err, ErrNoPassphrase))
+}
+
+func TestEncryptAndDecryptExistingSigningIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	original, _ := manager.PrivateKey()
+
+	assert.Nil(t, manager.EncryptSigningIdentity([]byte("secret")))
+	encrypted, _ := manager.IsEncrypted()
+	assert.True(t, encrypted)
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	reader.SetPassphraseProvider(func() ([]byte, error) { return []byte("secret"), nil })
+	assert.Nil(t, reader.DecryptSigningIdentity())
+	encrypted, _ = reader.IsEncrypted()
+	assert.False(t, encrypted)
+
+	plain := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	decrypted, _ := plain.PrivateKey()
+	assert.Equal(t, original.D, decrypted.D, "Migrating between encrypted and plain storage must keep the key")
+}
@@ -0,0 +1,168 @@
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// PrivateKeyEnvironmentVariableName is the environment variable that holds the PEM encoded private key, or its base64 encoding
+const PrivateKeyEnvironmentVariableName = string("SPUTNIK_CLOUDKIT_PRIVATE_KEY")
+
+// PrivateKeyFileEnvironmentVariableName is the environment variable that holds the path to a PEM encoded private key, e.g. on a mounted volume
+const PrivateKeyFileEnvironmentVariableName = string("SPUTNIK_CLOUDKIT_PRIVATE_KEY_FILE")
+
+// ErrReadOnly is returned when a signing identity can't be changed because it isn't managed by sputnik, e.g. when it is read from the environment
+var ErrReadOnly = errors.New("the signing identity is read-only")
+
+// EnvironmentKeyManager is a KeyManagerV2 that reads the signing identity and the Key ID from environment variables.
+//
+// The private key is read from SPUTNIK_CLOUDKIT_PRIVATE_KEY or, if that isn't set, from the file SPUTNIK_CLOUDKIT_PRIVATE_KEY_FILE points to.
+// The Key ID is read from SPUTNIK_CLOUDKIT_KEYID.
+type EnvironmentKeyManager struct {
+	mutex              sync.Mutex
+	inMemoryPrivateKey *ecdsa.PrivateKey
+	passphrase         PassphraseProvider
+}
+
+// NewEnvironmentKeyManager returns an EnvironmentKeyManager
+func NewEnvironmentKeyManager() *EnvironmentKeyManager {
+	return &EnvironmentKeyManager{passphrase: EnvironmentPassphrase}
+}
+
+// EnvironmentKeyConfigured tells whether one of the private key environment variables is set
+func EnvironmentKeyConfigured() bool {
+	return len(os.Getenv(PrivateKeyEnvironmentVariableName)) > 0 || len(os.Getenv(PrivateKeyFileEnvironmentVariableName)) > 0
+}
+
+// SetPassphraseProvider sets where the passphrase of an encrypted private key comes from
+func (e *EnvironmentKeyManager) SetPassphraseProvider(provider PassphraseProvider) {
+	e.passphrase = provider
+}
+
+// Name identifies the EnvironmentKeyManager as a Source of a Chain
+func (e *EnvironmentKeyManager) Name() string {
+	return "environment"
+}
+
+// PrivateKeySource describes the environment variable the private key of a Chain came from
+func (e *EnvironmentKeyManager) PrivateKeySource() string {
+	return e.Source()
+}
+
+// KeyIDSource describes the environment variable the Key ID of a Chain came from
+func (e *EnvironmentKeyManager) KeyIDSource() string {
+	return "environment variable " + KeyIDEnvironmentVariableName
+}
+
+// Source describes where the private key is read from
+func (e *EnvironmentKeyManager) Source() string {
+	if len(os.Getenv(PrivateKeyEnvironmentVariableName)) > 0 {
+		return "environment variable " + PrivateKeyEnvironmentVariableName
+	}
+	return fmt.Sprintf("file %s (from environment variable %s)", os.Getenv(PrivateKeyFileEnvironmentVariableName), PrivateKeyFileEnvironmentVariableName)
+}
+
+// PrivateKey returns the private key from the environment
+func (e *EnvironmentKeyManager) PrivateKey() (*ecdsa.PrivateKey, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.inMemoryPrivateKey != nil {
+		return e.inMemoryPrivateKey, nil
+	}
+
+	pemBytes, err := e.pemBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	if isEncryptedPrivateKey(pemBytes) {
+		privateKey, err = decryptWith(pemBytes, e.passphrase)
+	} else {
+		privateKey, err = parsePrivateKey(pemBytes)
+		if err != nil {
+			err = fmt.Errorf("%w: %w", ErrInvalidIdentity, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.inMemoryPrivateKey = privateKey
+	return privateKey, nil
+}
+
+// Reload drops the cached private key, so that it is read from the environment again on its next use
+func (e *EnvironmentKeyManager) Reload() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.inMemoryPrivateKey = nil
+}
+
+// Signer returns the private key from the environment as a crypto.Signer
+func (e *EnvironmentKeyManager) Signer() (crypto.Signer, error) {
+	return signerOf(e.PrivateKey())
+}
+
+// PublicKey returns the public key of the private key from the environment
+func (e *EnvironmentKeyManager) PublicKey() (*ecdsa.PublicKey, error) {
+	privateKey, err := e.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// KeyID returns the Key ID from SPUTNIK_CLOUDKIT_KEYID
+func (e *EnvironmentKeyManager) KeyID() (string, error) {
+	keyID := os.Getenv(KeyIDEnvironmentVariableName)
+	if len(keyID) == 0 {
+		return "", fmt.Errorf("%w: %s is not set", ErrNoKeyID, KeyIDEnvironmentVariableName)
+	}
+	return keyID, nil
+}
+
+// RemoveSigningIdentity always fails, the environment can't be changed by sputnik
+func (e *EnvironmentKeyManager) RemoveSigningIdentity() error {
+	return ErrReadOnly
+}
+
+// StoreKeyID always fails, the environment can't be changed by sputnik
+func (e *EnvironmentKeyManager) StoreKeyID(key string) error {
+	return ErrReadOnly
+}
+
+// pemBytes returns the PEM from the environment variable, decoding it from base64 if necessary, or from the file
+func (e *EnvironmentKeyManager) pemBytes() ([]byte, error) {
+	if value := os.Getenv(PrivateKeyEnvironmentVariableName); len(value) > 0 {
+		if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+			return []byte(value), nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s is neither PEM nor base64 encoded PEM", ErrInvalidIdentity, PrivateKeyEnvironmentVariableName)
+		}
+		return decoded, nil
+	}
+
+	path := os.Getenv(PrivateKeyFileEnvironmentVariableName)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: neither %s nor %s is set", ErrNoIdentity, PrivateKeyEnvironmentVariableName, PrivateKeyFileEnvironmentVariableName)
+	}
+
+	// the variable names the key explicitly, so a missing file must not hand over to another signing identity
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidIdentity, PrivateKeyFileEnvironmentVariableName, err)
+	}
+	return pemBytes, nil
+}
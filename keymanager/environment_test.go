@@ -0,0 +1,90 @@
+package keymanager
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixturePEM(t *testing.T) string {
+	pemBytes, err := ioutil.ReadFile("./fixtures/eckey.pem")
+	assert.Nil(t, err)
+	return string(pemBytes)
+}
+
+func fixtureKeyManager() CloudKitKeyManager {
+	return NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+}
+
+func TestEnvironmentKeyManagerReadsPEM(t *testing.T) {
+	t.Setenv(PrivateKeyEnvironmentVariableName, fixturePEM(t))
+	t.Setenv(KeyIDEnvironmentVariableName, "env key id")
+
+	manager := NewEnvironmentKeyManager()
+	privateKey, err := manager.PrivateKey()
+	assert.Nil(t, err)
+
+	fixture := fixtureKeyManager()
+	expected, _ := fixture.PrivateKey()
+	assert.Equal(t, expected.D, privateKey.D)
+
+	keyID, err := manager.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "env key id", keyID)
+	assert.Equal(t, "environment variable SPUTNIK_CLOUDKIT_PRIVATE_KEY", manager.Source())
+}
+
+func TestEnvironmentKeyManagerReadsBase64PEM(t *testing.T) {
+	t.Setenv(PrivateKeyEnvironmentVariableName, base64.StdEncoding.EncodeToString([]byte(fixturePEM(t))))
+
+	_, err := NewEnvironmentKeyManager().PrivateKey()
+	assert.Nil(t, err, "A base64 encoded PEM should be accepted")
+}
+
+func TestEnvironmentKeyManagerReadsFile(t *testing.T) {
+	t.Setenv(PrivateKeyFileEnvironmentVariableName, "./fixtures/eckey.pem")
+
+	manager := NewEnvironmentKeyManager()
+	_, err := manager.PrivateKey()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(manager.Source(), "file ./fixtures/eckey.pem"))
+}
+
+func TestEnvironmentKeyManagerWithoutKey(t *testing.T) {
+	t.Setenv(PrivateKeyEnvironmentVariableName, "")
+	t.Setenv(PrivateKeyFileEnvironmentVariableName, "")
+	t.Setenv(KeyIDEnvironmentVariableName, "")
+
+	manager := NewEnvironmentKeyManager()
+	_, err := manager.PrivateKey()
+	assert.True(t, errors.Is(err, ErrNoIdentity))
+
+	_, err = manager.KeyID()
+	assert.True(t, errors.Is(err, ErrNoKeyID))
+}
+
+func TestEnvironmentKeyManagerIsReadOnly(t *testing.T) {
+	manager := NewEnvironmentKeyManager()
+	assert.True(t, errors.Is(manager.StoreKeyID("key"), ErrReadOnly))
+	assert.True(t, errors.Is(manager.RemoveSigningIdentity(), ErrReadOnly))
+}
+
+func TestNewSelectsEnvironmentKey(t *testing.T) {
+	t.Setenv(PrivateKeyEnvironmentVariableName, fixturePEM(t))
+
+	manager := New()
+	assert.Equal(t, "environment variable SPUTNIK_CLOUDKIT_PRIVATE_KEY", manager.KeySource())
+
+	exists, _ := manager.SigningIdentityExists()
+	assert.True(t, exists, "A key from the environment is an existing signing identity")
+	assert.True(t, errors.Is(manager.RemoveSigningIdentity(), ErrReadOnly))
+}
+
+func TestKeySourceOfSecretsFolder(t *testing.T) {
+	manager := fixtureKeyManager()
+	assert.Equal(t, "file ./fixtures/eckey.pem", manager.KeySource())
+}
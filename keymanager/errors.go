@@ -0,0 +1,47 @@
+package keymanager
+
+import "errors"
+
+var (
+	// ErrNoIdentity is returned when there is no signing identity to read the keys from
+	ErrNoIdentity = errors.New("no signing identity found")
+
+	// ErrIdentityExists is returned when a signing identity would overwrite an existing one
+	ErrIdentityExists = errors.New("a signing identity already exists")
+
+	// ErrInvalidBinding is returned for bindings that don't name a container and a CloudKit environment, see Binding
+	ErrInvalidBinding = errors.New("invalid binding")
+
+	// ErrInvalidBundle is returned when a bundle can't be read or doesn't contain a usable signing identity
+	ErrInvalidBundle = errors.New("invalid identity bundle")
+
+	// ErrInvalidIdentity is returned when the signing identity exists but can't be read as an EC private key
+	ErrInvalidIdentity = errors.New("the signing identity is not a valid EC private key")
+
+	// ErrNoKeyID is returned when neither the environment nor the secrets folder provide a CloudKit Key ID
+	ErrNoKeyID = errors.New("no CloudKit Key ID found")
+
+	// ErrUnsupportedKey is returned for keys other than P-256 ECDSA keys, which are the only ones CloudKit accepts
+	ErrUnsupportedKey = errors.New("CloudKit requires a P-256 ECDSA key")
+
+	// ErrNotExportable is returned by KeyManagers that sign without ever handing out the private key, e.g. because it lives in an HSM
+	ErrNotExportable = errors.New("the private key can't be exported")
+
+	// ErrNoPassphrase is returned when a signing identity needs to be encrypted or decrypted but no passphrase is available
+	ErrNoPassphrase = errors.New("no passphrase was provided")
+
+	// ErrWrongPassphrase is returned when an encrypted signing identity can't be decrypted with the given passphrase
+	ErrWrongPassphrase = errors.New("the passphrase does not decrypt the signing identity")
+
+	// ErrNoSecretsFolder is returned when the secrets folder can't be determined, because neither SPUTNIK_SECRETS_DIR, XDG_CONFIG_HOME nor a home directory is available
+	ErrNoSecretsFolder = errors.New("no secrets folder, set SPUTNIK_SECRETS_DIR")
+
+	// ErrNoProfile is returned when a named profile doesn't exist in the secrets folder
+	ErrNoProfile = errors.New("no such profile")
+
+	// ErrInsecurePermissions is returned when every user can change a secret or it is owned by another user
+	ErrInsecurePermissions = errors.New("the secrets folder is accessible to other users")
+
+	// ErrInvalidProfileName is returned for profile names that can't be used as a folder name in the secrets folder
+	ErrInvalidProfileName = errors.New("invalid profile name")
+)
@@ -0,0 +1,77 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrivateKeyFormats(t *testing.T) {
+	fixture, _ := ioutil.ReadFile("./fixtures/eckey.pem")
+	key, _ := parsePrivateKey(fixture)
+	sec1, _ := x509.MarshalECPrivateKey(key)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	formats := map[string][]byte{
+		"SEC1 PEM":   fixture,
+		"PKCS#8 PEM": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		"SEC1 DER":   sec1,
+		"PKCS#8 DER": pkcs8,
+	}
+	for name, data := range formats {
+		parsed, err := ParsePrivateKey(data)
+		assert.Nil(t, err, name)
+		if parsed != nil {
+			assert.Equal(t, key.D, parsed.D, name)
+		}
+	}
+}
+
+func TestParsePrivateKeyDERFixture(t *testing.T) {
+	der, _ := ioutil.ReadFile("./fixtures/test_identity.der")
+	_, err := ParsePrivateKey(der)
+	assert.Nil(t, err)
+}
+
+func TestParsePrivateKeyRejectsOtherCurves(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+
+	_, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	assert.True(t, errors.Is(err, ErrUnsupportedKey), "Only P-256 keys can be used with CloudKit")
+}
+
+func TestImportSigningIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	der, _ := ioutil.ReadFile("./fixtures/test_identity.der")
+	expected, _ := ParsePrivateKey(der)
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.Nil(t, manager.ImportSigningIdentity(der, nil))
+
+	pemBytes, _ := ioutil.ReadFile("./testFiles/eckey.pem")
+	block, _ := pem.Decode(pemBytes)
+	assert.Equal(t, "EC PRIVATE KEY", block.Type, "Imported keys should be stored in the format the key manager writes itself")
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	imported, _ := reader.PrivateKey()
+	assert.Equal(t, expected.D, imported.D)
+}
+
+func TestImportSigningIdentityKeepsExistingIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+
+	der, _ := ioutil.ReadFile("./fixtures/test_identity.der")
+	err := manager.ImportSigningIdentity(der, nil)
+	assert.True(t, errors.Is(err, ErrIdentityExists))
+}
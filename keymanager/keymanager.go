@@ -1,14 +1,13 @@
 package keymanager
 
 import (
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"os/user"
+	"path/filepath"
 	"strings"
 
 	log "github.com/apex/log"
@@ -17,7 +16,20 @@ import (
 // KeyIDEnvironmentVariableName is the constant used for identifying the Key ID environment variable
 const KeyIDEnvironmentVariableName = string("SPUTNIK_CLOUDKIT_KEYID")
 
+// SecretsFolderEnvironmentVariableName is the environment variable that overrides the default secrets folder
+const SecretsFolderEnvironmentVariableName = string("SPUTNIK_SECRETS_DIR")
+
+const (
+	// defaultKeyIDFileName is the name of the file the Key ID is stored in
+	defaultKeyIDFileName = "keyid.txt"
+	// defaultPemFileName is the name of the file the PEM encoded private key is stored in
+	defaultPemFileName = "eckey.pem"
+)
+
 // KeyManager exposes methods for creating, reading and removing signing identity relevant keys and IDs
+//
+// Deprecated: KeyManager can't report why a key or key ID is missing. Implement KeyManagerV2 instead
+// and wrap existing implementations with Adapt.
 type KeyManager interface {
 	PublicKey() *ecdsa.PublicKey
 	PrivateKey() *ecdsa.PrivateKey
@@ -26,27 +38,79 @@ type KeyManager interface {
 	StoreKeyID(key string) error
 }
 
-// CloudKitKeyManager is a concrete KeyManager
+// KeyManagerV2 exposes methods for creating, reading and removing signing identity relevant keys and IDs.
+//
+// Unlike KeyManager, every lookup reports failures as an error. Missing values are reported as ErrNoIdentity and ErrNoKeyID.
+// Requests are signed through the crypto.Signer, so implementations backed by HSMs, KMS clients or agents never need to hand out the private key.
+type KeyManagerV2 interface {
+	PublicKey() (*ecdsa.PublicKey, error)
+	Signer() (crypto.Signer, error)
+	KeyID() (string, error)
+	RemoveSigningIdentity() error
+	StoreKeyID(key string) error
+}
+
+// CloudKitKeyManager is a concrete KeyManagerV2
 type CloudKitKeyManager struct {
-	secretsFolder      string
-	pemFileName        string
-	keyIDFileName      string
-	inMemoryKeyID      string
-	inMemoryPrivateKey *ecdsa.PrivateKey
-	inMemoryPublicKey  *ecdsa.PublicKey
+	profile       string
+	secretsFolder string
+	pemFileName   string
+	keyIDFileName string
+	cache         *keyCache
+	passphrase    PassphraseProvider
+	environment   *EnvironmentKeyManager
 }
 
-// New returns a CloudKitKeyManager with the default secrets folder
-// By default, a CloudKitKeyManager expects the secrets in the .sputnik folder of the home directory
+// New returns a CloudKitKeyManager for the active profile in the default secrets folder, see DefaultSecretsFolder.
+// When SPUTNIK_CLOUDKIT_PRIVATE_KEY or SPUTNIK_CLOUDKIT_PRIVATE_KEY_FILE is set, the private key is read from the environment instead.
+//
+// Without a secrets folder, see ErrNoSecretsFolder, the error is logged and every lookup and write of the returned key manager fails.
 func New() CloudKitKeyManager {
-	homeDir := homeDir()
-	components := []string{homeDir, ".sputnik", "secrets"}
-	secretsFolder := strings.Join(components, "/")
+	secretsFolder, err := DefaultSecretsFolder()
+	if err != nil {
+		log.Errorf("%s", err)
+		manager := CloudKitKeyManager{profile: DefaultProfile}
+		if EnvironmentKeyConfigured() {
+			manager.environment = NewEnvironmentKeyManager()
+		}
+		return manager
+	}
+
+	manager, err := NewInSecretsFolder(secretsFolder, "")
+	if err != nil {
+		log.Warnf("Falling back to the %s profile (%s)", DefaultProfile, err)
+		manager, _ = NewWithProfile(DefaultProfile)
+	}
+	return manager
+}
+
+// DefaultSecretsFolder returns the path to Sputnik's secrets folder, in order of precedence:
+//   - the folder given by SPUTNIK_SECRETS_DIR
+//   - the secrets folder in the .sputnik folder of the home directory, when it exists
+//   - the secrets folder in $XDG_CONFIG_HOME/sputnik, when XDG_CONFIG_HOME is set
+//   - the secrets folder in the .sputnik folder of the home directory
+//
+// Without SPUTNIK_SECRETS_DIR, XDG_CONFIG_HOME and a home directory, ErrNoSecretsFolder is returned.
+func DefaultSecretsFolder() (string, error) {
+	if folder := os.Getenv(SecretsFolderEnvironmentVariableName); len(folder) > 0 {
+		return folder, nil
+	}
 
-	keyIDFileName := "keyid.txt"
-	pemFileName := "eckey.pem"
+	home, homeErr := homeDir()
+	legacy := filepath.Join(home, ".sputnik", "secrets")
+	if homeErr == nil {
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
 
-	return NewWithSecretsFolder(secretsFolder, keyIDFileName, pemFileName)
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); len(xdgConfigHome) > 0 {
+		return filepath.Join(xdgConfigHome, "sputnik", "secrets"), nil
+	}
+	if homeErr != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoSecretsFolder, homeErr)
+	}
+	return legacy, nil
 }
 
 // NewWithSecretsFolder returns a CloudKitKeyManager with a specific secrets folder
@@ -55,114 +119,277 @@ func NewWithSecretsFolder(secretsFolder string, keyIDFileName string, pemFileNam
 	return CloudKitKeyManager{
 		secretsFolder: secretsFolder,
 		pemFileName:   pemFileName,
-		keyIDFileName: keyIDFileName}
+		keyIDFileName: keyIDFileName,
+		cache:         &keyCache{},
+		passphrase:    EnvironmentPassphrase}
 }
 
-// KeyID looks up the CloudKit Key ID
-func (c *CloudKitKeyManager) KeyID() string {
-	keyID := os.Getenv("SPUTNIK_CLOUDKIT_KEYID")
-	if len(keyID) <= 0 {
-		// no KeyID found in environment variables
-		keyIDFromFile, err := c.storedKeyID()
-		if err != nil {
+// SetPassphraseProvider sets where the passphrase of an encrypted signing identity comes from.
+// By default it is read from the environment, see EnvironmentPassphrase.
+func (c *CloudKitKeyManager) SetPassphraseProvider(provider PassphraseProvider) {
+	c.passphrase = provider
+	if c.environment != nil {
+		c.environment.SetPassphraseProvider(provider)
+	}
+}
 
-		}
-		return keyIDFromFile
+// KeySource describes where the private key is read from: the environment or a file in the secrets folder
+func (c *CloudKitKeyManager) KeySource() string {
+	if c.environment != nil {
+		return c.environment.Source()
 	}
-	return keyID
+	return "file " + c.pemFilePath()
+}
+
+// Profile returns the name of the profile the CloudKitKeyManager reads its signing identity from
+func (c *CloudKitKeyManager) Profile() string {
+	if len(c.profile) == 0 {
+		return DefaultProfile
+	}
+	return c.profile
+}
+
+// KeyID looks up the CloudKit Key ID
+//
+// The environment variable SPUTNIK_CLOUDKIT_KEYID takes precedence over the Key ID file in the secrets folder.
+func (c *CloudKitKeyManager) KeyID() (string, error) {
+	keyID := os.Getenv(KeyIDEnvironmentVariableName)
+	if len(keyID) > 0 {
+		return keyID, nil
+	}
+
+	// no KeyID found in environment variables
+	return c.storedKeyID()
 }
 
 // StoreKeyID stores the given ID to a file in Sputnik's secrets folder
 func (c *CloudKitKeyManager) StoreKeyID(key string) error {
-	path := c.keyIDFilePath()
-	keyBytes := []byte(key)
-	return ioutil.WriteFile(path, keyBytes, 0644)
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.writeKeyID(key)
 }
 
-// storedKeyID looks up the Key ID in a file
-func (c *CloudKitKeyManager) storedKeyID() (string, error) {
-	if len(c.inMemoryKeyID) > 0 {
-		return c.inMemoryKeyID, nil
+// writeKeyID replaces the Key ID file. The caller needs to hold the lock.
+func (c *CloudKitKeyManager) writeKeyID(key string) error {
+	err := writeFileAtomic(c.keyIDFilePath(), []byte(key), secretsFileMode)
+	if err == nil {
+		c.state().storeKeyID(key)
 	}
+	return err
+}
 
-	path := c.keyIDFilePath()
-	keyBytes, err := ioutil.ReadFile(path)
-	if err != nil {
+// storedKeyID looks up the Key ID in a file, once per generation of the cache
+func (c *CloudKitKeyManager) storedKeyID() (string, error) {
+	cache := c.state()
+	cache.Lock()
+	defer cache.Unlock()
+
+	if err := c.load(cache); err != nil {
 		return "", err
 	}
-	c.inMemoryKeyID = string(keyBytes)
 
-	return c.inMemoryKeyID, nil
+	if cache.pemBytes == nil && cache.privateKey == nil {
+		if previous, ok := c.fallback(); ok {
+			return previous.KeyID()
+		}
+	}
+	if len(cache.keyID) > 0 {
+		return cache.keyID, nil
+	}
+	return "", fmt.Errorf("%w: %s is missing or empty", ErrNoKeyID, c.keyIDFilePath())
 }
 
 // PrivateKey returns the x509 private key that was generated when creating the signing identity
-func (c *CloudKitKeyManager) PrivateKey() *ecdsa.PrivateKey {
-	if c.inMemoryPrivateKey != nil {
-		return c.inMemoryPrivateKey
+//
+// While the PEM file of the signing identity is missing, the previous identity of a rotation is used until its grace period has ended.
+// Any other failure to read the key is returned as is, see fallback. Requests CloudKit rejects are retried with FallbackIdentity. The key is read once per generation of the cache,
+// concurrent callers wait for the first one to read it.
+func (c *CloudKitKeyManager) PrivateKey() (*ecdsa.PrivateKey, error) {
+	if c.environment != nil {
+		return c.environment.PrivateKey()
+	}
+
+	cache := c.state()
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.privateKey != nil {
+		return cache.privateKey, nil
 	}
 
-	inPathPem := c.pemFilePath()
-	command := exec.Command("openssl", "ec", "-outform", "der", "-in", inPathPem)
-	bytes, _ := command.Output()
+	if err := c.load(cache); err != nil {
+		return nil, err
+	}
+	if cache.pemBytes == nil {
+		if previous, ok := c.fallback(); ok {
+			return previous.PrivateKey()
+		}
+		return nil, fmt.Errorf("%w: %s doesn't exist", ErrNoIdentity, c.pemFilePath())
+	}
 
-	privateKey, err := x509.ParseECPrivateKey(bytes)
+	privateKey, err := c.privateKeyFromPEM(cache.pemBytes)
 	if err != nil {
-		log.Error("Failed to parse private ec key from pem:")
-		log.Errorf("%s", err)
+		return nil, err
+	}
+
+	cache.privateKey = privateKey
+	return cache.privateKey, nil
+}
+
+// load reads the PEM and the Key ID files under the shared lock of the secrets folder, once per generation of the cache.
+//
+// Reading both at once means the private key and the Key ID always belong together, even if a rotation replaces them in between two lookups.
+// The caller needs to hold the cache's mutex.
+func (c *CloudKitKeyManager) load(cache *keyCache) error {
+	if cache.loaded {
 		return nil
 	}
+	if len(c.secretsFolder) == 0 {
+		return ErrNoSecretsFolder
+	}
+	c.pruneExpiredPreviousIdentity()
 
-	c.inMemoryPrivateKey = privateKey
-	return c.inMemoryPrivateKey
+	unlock, err := c.readLock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := verifyPermissions(c.folders(), c.pemFilePath(), c.keyIDFilePath()); err != nil {
+		return err
+	}
+	pemBytes, err := ioutil.ReadFile(c.pemFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	keyIDBytes, err := ioutil.ReadFile(c.keyIDFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	cache.loaded = true
+	cache.pemBytes = pemBytes
+	if len(cache.keyID) == 0 && len(strings.TrimSpace(string(keyIDBytes))) > 0 {
+		cache.keyID = string(keyIDBytes)
+	}
+	return nil
 }
 
-// PublicKey returns the public key that was generated when creating the signing identity
-func (c *CloudKitKeyManager) PublicKey() *ecdsa.PublicKey {
-	if c.inMemoryPublicKey != nil {
-		return c.inMemoryPublicKey
+// readPrivateKey reads and parses the PEM, bypassing the cache. The caller needs to hold the lock.
+func (c *CloudKitKeyManager) readPrivateKey() (*ecdsa.PrivateKey, error) {
+	pemBytes, err := ioutil.ReadFile(c.pemFilePath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %w", ErrNoIdentity, err)
+	} else if err != nil {
+		return nil, err
+	}
+	return c.privateKeyFromPEM(pemBytes)
+}
+
+// privateKeyFromPEM parses a plain or an encrypted private key, asking the passphrase provider for the passphrase of the latter
+func (c *CloudKitKeyManager) privateKeyFromPEM(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	if !isEncryptedPrivateKey(pemBytes) {
+		privateKey, err := parsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidIdentity, err)
+		}
+		return privateKey, nil
 	}
 
+	return decryptWith(pemBytes, c.passphrase)
+}
+
+// IsEncrypted tells whether the signing identity is stored encrypted with a passphrase
+func (c *CloudKitKeyManager) IsEncrypted() (bool, error) {
+	var pemBytes []byte
 	var err error
-	var pub interface{}
-	pemString := c.PublicKeyString()
-	pemData := []byte(pemString)
-	block, _ := pem.Decode(pemData)
-	if block == nil || block.Type != "PUBLIC KEY" {
-		err = errors.New("failed to decode PEM block containing public key")
+	if c.environment != nil {
+		pemBytes, err = c.environment.pemBytes()
 	} else {
-		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		pemBytes, err = ioutil.ReadFile(c.pemFilePath())
+	}
+	if os.IsNotExist(err) {
+		return false, fmt.Errorf("%w: %w", ErrNoIdentity, err)
+	} else if err != nil {
+		return false, err
+	}
+	return isEncryptedPrivateKey(pemBytes), nil
+}
 
-		switch pub := pub.(type) {
-		case *ecdsa.PublicKey:
-			c.inMemoryPublicKey = pub
-			return pub
-		}
+// EncryptSigningIdentity encrypts the existing signing identity with the given passphrase
+func (c *CloudKitKeyManager) EncryptSigningIdentity(passphrase []byte) error {
+	privateKey, err := c.PrivateKey()
+	if err != nil {
+		return err
 	}
 
+	unlock, err := c.lock()
 	if err != nil {
-		log.Error("unable to parse public key from certificate:")
-		log.Errorf("%s", err)
+		return err
+	}
+	defer unlock()
+	return c.writePrivateKey(privateKey, passphrase)
+}
+
+// DecryptSigningIdentity stores the existing, encrypted signing identity without encryption.
+// The passphrase is taken from the passphrase provider.
+func (c *CloudKitKeyManager) DecryptSigningIdentity() error {
+	privateKey, err := c.PrivateKey()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.writePrivateKey(privateKey, nil)
+}
+
+// Signer returns the private key that was generated when creating the signing identity as a crypto.Signer
+func (c *CloudKitKeyManager) Signer() (crypto.Signer, error) {
+	return signerOf(c.PrivateKey())
+}
+
+// PublicKey returns the public key that was generated when creating the signing identity
+func (c *CloudKitKeyManager) PublicKey() (*ecdsa.PublicKey, error) {
+	privateKey, err := c.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
 }
 
 // PublicKeyString should be named differently. It reads and returns the public part of the PEM encoded signing identity
 func (c *CloudKitKeyManager) PublicKeyString() string {
-	ecKeyPath := c.pemFilePath()
+	publicKey, err := c.PublicKey()
+	if err != nil {
+		log.Error("PublicKeyString")
+		log.Errorf("%s", err)
+		return ""
+	}
 
-	command := exec.Command("openssl", "ec", "-in", ecKeyPath, "-pubout")
-	bytes, err := command.Output()
+	pemBytes, err := encodePublicKey(publicKey)
 	if err != nil {
 		log.Error("PublicKeyString")
-		log.Error("Failed to read the public key from PEM")
+		log.Error("Failed to encode the public key as PEM")
 		log.Errorf("%s", err)
+		return ""
 	}
-	return string(bytes)
+	return string(pemBytes)
 }
 
-// SigningIdentityExists checks if a signing identity has been created
+// SigningIdentityExists checks if a signing identity has been created or is provided by the environment
 func (c *CloudKitKeyManager) SigningIdentityExists() (bool, error) {
+	if c.environment != nil {
+		return true, nil
+	}
+
 	ecKeyPath := c.pemFilePath()
 
 	file, openError := os.Open(ecKeyPath)
@@ -185,65 +412,111 @@ func (c *CloudKitKeyManager) pemFilePath() string {
 
 // ECKey should be named differently. It returns the public part of the PEM encoded signing identity
 func (c *CloudKitKeyManager) ECKey() string {
-	ecKeyPath := c.pemFilePath()
-
-	command := exec.Command("openssl", "ec", "-in", ecKeyPath, "-pubout")
-
-	bytes, err := command.Output()
-	if err != nil {
-		log.Error("ECKey")
-		log.Error("Failed to read the public key from PEM")
-		log.Errorf("%s", err)
-	}
-	return string(bytes)
+	return c.PublicKeyString()
 }
 
 // CreateSigningIdentity creates a new signing identity.
 //
 // You can paste the signing identity to your iCloud Dashboard when creating a new API Access Key.
 func (c *CloudKitKeyManager) CreateSigningIdentity() error {
-	return c.createPemEncodedCertificate()
+	return c.createPemEncodedCertificate(nil)
 }
 
-// RemoveSigningIdentity removes the existing signing identity
-func (c *CloudKitKeyManager) RemoveSigningIdentity() error {
-	c.inMemoryPrivateKey = nil
-	c.inMemoryPublicKey = nil
+// CreateEncryptedSigningIdentity creates a new signing identity that is stored encrypted with the given passphrase.
+func (c *CloudKitKeyManager) CreateEncryptedSigningIdentity(passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return ErrNoPassphrase
+	}
+	return c.createPemEncodedCertificate(passphrase)
+}
 
-	removePemCommand := exec.Command("rm", c.pemFilePath())
-	err := removePemCommand.Run()
+// ImportSigningIdentity stores an existing P-256 private key as the signing identity, encrypted if a passphrase is given.
+//
+// The key may be SEC1 or PKCS#8, PEM or DER encoded, see ParsePrivateKey. An existing signing identity is never overwritten.
+func (c *CloudKitKeyManager) ImportSigningIdentity(data []byte, passphrase []byte) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+
+	privateKey, err := ParsePrivateKey(data)
 	if err != nil {
-		log.Error("Unable to remove PEM:")
-		log.Errorf("%s", err)
+		return err
 	}
 
-	removeKeyIDCommand := exec.Command("rm", c.keyIDFilePath())
-	err = removeKeyIDCommand.Run()
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	return err
+	if _, err := os.Stat(c.pemFilePath()); err == nil {
+		return fmt.Errorf("%w: %s", ErrIdentityExists, c.pemFilePath())
+	}
+
+	return c.writePrivateKey(privateKey, passphrase)
 }
 
-// createPemEncodedCertificate creates the PEM encoded certificate and stores it
-func (c *CloudKitKeyManager) createPemEncodedCertificate() error {
+// createPemEncodedCertificate creates the PEM encoded certificate and stores it, encrypted if a passphrase is given
+func (c *CloudKitKeyManager) createPemEncodedCertificate(passphrase []byte) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
 	log.Debug("Creating PEM...")
-	pemFilePath := c.pemFilePath()
 
-	command := exec.Command("openssl", "ecparam", "-name", "prime256v1", "-genkey", "-noout", "-out", pemFilePath)
-	err := command.Start()
+	privateKey, err := generatePrivateKey()
 	if err != nil {
-		log.Error("Failed to create pem encoded certificate")
+		log.Error("Failed to generate the private key")
 		log.Errorf("%s", err)
+		return err
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	err = command.Wait()
+	err = c.writePrivateKey(privateKey, passphrase)
 	if err != nil {
-		log.Error("Error executing `openssl`")
+		log.Error("Failed to create pem encoded certificate")
 		log.Errorf("%s", err)
+		return err
 	}
 
 	log.Info("Done creating PEM")
 
-	return err
+	return nil
+}
+
+// writePrivateKey stores the given private key as PEM, encrypted if a passphrase is given. The caller needs to hold the lock.
+func (c *CloudKitKeyManager) writePrivateKey(privateKey *ecdsa.PrivateKey, passphrase []byte) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+
+	var pemBytes []byte
+	var err error
+	if len(passphrase) > 0 {
+		pemBytes, err = encryptPrivateKey(privateKey, passphrase)
+	} else {
+		pemBytes, err = encodePrivateKey(privateKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(c.pemFilePath(), pemBytes, secretsFileMode)
+	if err != nil {
+		return err
+	}
+
+	err = c.updateMetadata(privateKey)
+	if err != nil {
+		return err
+	}
+
+	c.state().storePrivateKey(privateKey)
+	return nil
 }
 
 // SecretsFolder returns the path to Sputnik's secrets folder
@@ -263,17 +536,27 @@ func (c *CloudKitKeyManager) SecretsFolder() string {
 	return file.Name()
 }
 
+// folders returns the folder of the signing identity and, for named profiles, the folders of the secrets folder it is nested in
+func (c *CloudKitKeyManager) folders() []string {
+	folders := []string{c.secretsFolder}
+	if profiles := filepath.Dir(c.secretsFolder); filepath.Base(profiles) == profilesFolderName {
+		folders = append(folders, profiles, filepath.Dir(profiles))
+	}
+	return folders
+}
+
 func createSecretsFolder(in string) (string, error) {
-	mode := int(0755)
-	return in, os.MkdirAll(in, os.FileMode(mode))
+	return in, os.MkdirAll(in, secretsFolderMode)
 }
 
-func homeDir() string {
-	usr, err := user.Current()
+// homeDir returns the home directory of the current user. It fails e.g. on CI runners without HOME.
+func homeDir() (string, error) {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		// can't get current user
-		log.Errorf("%s", err)
+		return "", err
 	}
-
-	return usr.HomeDir
+	if len(home) == 0 {
+		return "", errors.New("the home directory is unknown")
+	}
+	return home, nil
 }
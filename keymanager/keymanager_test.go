@@ -1,6 +1,7 @@
 package keymanager
 
 import (
+	"errors"
 	"math/big"
 	"os"
 	"testing"
@@ -16,7 +17,36 @@ func TestNew(t *testing.T) {
 func TestStoredKeyID(t *testing.T) {
 	pathToFixtures := "./fixtures"
 	manager := NewWithSecretsFolder(pathToFixtures, "keyid.txt", "eckey.pem")
-	assert.Equal(t, "abc\n", manager.KeyID(), "A stored key id should get found")
+	keyID, err := manager.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc\n", keyID, "A stored key id should get found")
+}
+
+func TestKeyIDFromEnvironment(t *testing.T) {
+	t.Setenv(KeyIDEnvironmentVariableName, "from environment")
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	keyID, err := manager.KeyID()
+	assert.Nil(t, err)
+	assert.Equal(t, "from environment", keyID, "The environment should take precedence over the stored key id")
+}
+
+func TestMissingKeyID(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "missing.txt", "eckey.pem")
+	_, err := manager.KeyID()
+	assert.True(t, errors.Is(err, ErrNoKeyID), "A missing key id file should be reported as ErrNoKeyID")
+}
+
+func TestMissingPrivateKey(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "missing.pem")
+	privateKey, err := manager.PrivateKey()
+	assert.Nil(t, privateKey)
+	assert.True(t, errors.Is(err, ErrNoIdentity), "A missing PEM should be reported as ErrNoIdentity")
+}
+
+func TestInvalidPrivateKey(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "keyid.txt")
+	_, err := manager.PrivateKey()
+	assert.True(t, errors.Is(err, ErrInvalidIdentity), "A file that isn't a PEM should be reported as ErrInvalidIdentity")
 }
 
 func TestPrivateKey(t *testing.T) {
@@ -25,15 +55,17 @@ func TestPrivateKey(t *testing.T) {
 
 	expectedD := new(big.Int)
 	expectedD.SetString("57359333433306843951573675484597381433848383364258304847182053853963006392866", 10)
-	assert.Equal(t, expectedD, manager.PrivateKey().D, "The private key does not match the certificate")
+	privateKey, err := manager.PrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, expectedD, privateKey.D, "The private key does not match the certificate")
 }
 
 func TestPrivateKeyFromMemory(t *testing.T) {
 	pathToFixtures := "./fixtures"
 	manager := NewWithSecretsFolder(pathToFixtures, "keyid.txt", "eckey.pem")
 
-	privateKey := manager.PrivateKey()
-	privateKey = manager.PrivateKey()
+	_, _ = manager.PrivateKey()
+	privateKey, _ := manager.PrivateKey()
 	expectedD := new(big.Int)
 	expectedD.SetString("57359333433306843951573675484597381433848383364258304847182053853963006392866", 10)
 	assert.Equal(t, expectedD, privateKey.D, "The private key does not match the certificate")
@@ -43,7 +75,8 @@ func TestPublicKey(t *testing.T) {
 	pathToFixtures := "./fixtures"
 	manager := NewWithSecretsFolder(pathToFixtures, "keyid.txt", "eckey.pem")
 
-	publicKey := manager.PublicKey()
+	publicKey, err := manager.PublicKey()
+	assert.Nil(t, err)
 	expectedX := new(big.Int)
 	expectedX.SetString("83764337057786748884235593670888306280068598385338703097790983192099570881279", 10)
 	assert.Equal(t, expectedX, publicKey.X, "The public key's X does not match the certificate")
@@ -57,8 +90,8 @@ func TestPublicKeyFromMemory(t *testing.T) {
 	pathToFixtures := "./fixtures"
 	manager := NewWithSecretsFolder(pathToFixtures, "keyid.txt", "eckey.pem")
 
-	publicKey := manager.PublicKey()
-	publicKey = manager.PublicKey()
+	_, _ = manager.PublicKey()
+	publicKey, _ := manager.PublicKey()
 	expectedX := new(big.Int)
 	expectedX.SetString("83764337057786748884235593670888306280068598385338703097790983192099570881279", 10)
 	assert.Equal(t, expectedX, publicKey.X, "The public key's X does not match the certificate")
@@ -69,7 +102,8 @@ func TestStoreKeyID(t *testing.T) {
 	manager := NewWithSecretsFolder(pathToFixtures, "keyidCreateTest.txt", "eckeyTest.pem")
 
 	manager.StoreKeyID("key")
-	assert.Equal(t, "key", manager.KeyID(), "The key id should be stored correctly")
+	keyID, _ := manager.KeyID()
+	assert.Equal(t, "key", keyID, "The key id should be stored correctly")
 
 	_ = os.RemoveAll("./testFiles")
 }
@@ -125,7 +159,9 @@ func TestRemovesPublicKeyWhenRemovingSigningIdentity(t *testing.T) {
 
 	manager.RemoveSigningIdentity()
 
-	assert.Nil(t, manager.PublicKey(), "The public key should be gone after deleting the signing identity")
+	publicKey, err := manager.PublicKey()
+	assert.Nil(t, publicKey, "The public key should be gone after deleting the signing identity")
+	assert.True(t, errors.Is(err, ErrNoIdentity))
 
 	_ = os.RemoveAll("./testFiles")
 }
@@ -137,7 +173,9 @@ func TestRemovesPrivateKeyWhenRemovngSigningIdentity(t *testing.T) {
 
 	manager.RemoveSigningIdentity()
 
-	assert.Nil(t, manager.PrivateKey(), "The private key should be gone after deleting the signing identity")
+	privateKey, err := manager.PrivateKey()
+	assert.Nil(t, privateKey, "The private key should be gone after deleting the signing identity")
+	assert.True(t, errors.Is(err, ErrNoIdentity))
 
 	_ = os.RemoveAll("./testFiles")
 }
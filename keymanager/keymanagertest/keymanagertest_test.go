@@ -0,0 +1,32 @@
+package keymanagertest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeysAreFixed(t *testing.T) {
+	assert.Equal(t, Key().D, Key().D)
+	assert.NotEqual(t, Key().D, OtherKey().D)
+}
+
+func TestDeterministicSigner(t *testing.T) {
+	signer, err := KeyManager().Signer()
+	assert.Nil(t, err)
+	digest := sha256.Sum256([]byte("message"))
+
+	first, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.Nil(t, err)
+	second, _ := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.Equal(t, first, second, "Signing the same digest twice should result in the same signature")
+	assert.True(t, ecdsa.VerifyASN1(&Key().PublicKey, digest[:], first))
+}
+
+func TestClock(t *testing.T) {
+	assert.Equal(t, Time, Clock(Time)())
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package keymanager
+
+// lockFolder is a no-op on platforms without flock. Writes are still atomic, but concurrent writers aren't serialized.
+func lockFolder(folder string) (func(), error) {
+	return func() {}, nil
+}
+
+// lockFolderShared is a no-op on platforms without flock
+func lockFolderShared(folder string) (func(), error) {
+	return func() {}, nil
+}
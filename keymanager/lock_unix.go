@@ -0,0 +1,47 @@
+//go:build unix
+
+package keymanager
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFolder takes an exclusive flock on the lock file in the folder, waiting for other processes to release it
+func lockFolder(folder string) (func(), error) {
+	file, err := os.OpenFile(folder+"/"+lockFileName, os.O_CREATE|os.O_RDWR, secretsFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// lockFolderShared takes a shared flock on the lock file in the folder, waiting for a process holding the exclusive lock to release it.
+// Folders that were never locked for writing, e.g. fixtures, have no lock file and are read without locking.
+func lockFolderShared(folder string) (func(), error) {
+	file, err := os.Open(folder + "/" + lockFileName)
+	if os.IsNotExist(err) {
+		return func() {}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
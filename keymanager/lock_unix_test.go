@@ -0,0 +1,73 @@
+//go:build unix
+
+package keymanager
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockFolderIsExclusive(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	_ = os.MkdirAll("./testFiles", 0700)
+
+	unlock, err := lockFolder("./testFiles")
+	assert.Nil(t, err)
+
+	locked := make(chan struct{})
+	go func() {
+		unlockSecond, _ := lockFolder("./testFiles")
+		close(locked)
+		unlockSecond()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("The lock should be held by one writer at a time")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("The lock should be available after it was released")
+	}
+}
+
+func TestReadersWaitForRotation(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	_, _ = manager.StageSigningIdentity(nil)
+
+	// half of a rotation: the new private key is in place, the Key ID isn't yet
+	unlock, err := lockFolder("./testFiles")
+	assert.Nil(t, err)
+	staged := manager.rotationManager(stagedPrefix)
+	assert.Nil(t, renameAtomic(staged.pemFilePath(), manager.pemFilePath()))
+
+	read := make(chan string)
+	go func() {
+		reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+		_, keyID, _ := reader.Identity()
+		read <- keyID
+	}()
+
+	select {
+	case <-read:
+		t.Fatal("Readers should wait while the signing identity is being replaced")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Nil(t, writeFileAtomic(manager.keyIDFilePath(), []byte("new key id"), secretsFileMode))
+	unlock()
+	select {
+	case keyID := <-read:
+		assert.Equal(t, "new key id", keyID)
+	case <-time.After(time.Second):
+		t.Fatal("Readers should continue once the signing identity was replaced")
+	}
+}
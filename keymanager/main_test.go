@@ -0,0 +1,15 @@
+package keymanager
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain restricts the fixtures to their owner before the tests load them. Git doesn't keep file modes, so a checkout
+// leaves them readable by others, which PrivateKey and KeyID refuse.
+func TestMain(m *testing.M) {
+	if _, err := FixPermissions("./fixtures"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,65 @@
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+)
+
+// MemoryKeyManager is a KeyManagerV2 for a signing identity that is held in memory only, e.g. one that a service loads from its own secret store.
+//
+// It never reads from or writes to the filesystem and can't be changed after it was created.
+type MemoryKeyManager struct {
+	signer crypto.Signer
+	keyID  string
+}
+
+// NewFromPEM returns a MemoryKeyManager for a P-256 private key and its Key ID.
+//
+// The key may be SEC1 or PKCS#8, PEM or DER encoded, see ParsePrivateKey. Invalid keys and empty Key IDs are reported right away.
+func NewFromPEM(pemBytes []byte, keyID string) (*MemoryKeyManager, error) {
+	privateKey, err := ParsePrivateKey(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIdentity, err)
+	}
+	return NewFromKey(privateKey, keyID)
+}
+
+// NewFromKey returns a MemoryKeyManager that signs with the given signer, which needs to hold a P-256 key.
+//
+// Invalid signers and empty Key IDs are reported right away.
+func NewFromKey(signer crypto.Signer, keyID string) (*MemoryKeyManager, error) {
+	if err := CheckSigner(signer); err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(keyID)) == 0 {
+		return nil, ErrNoKeyID
+	}
+	return &MemoryKeyManager{signer: signer, keyID: keyID}, nil
+}
+
+// PublicKey returns the public key of the signer
+func (m *MemoryKeyManager) PublicKey() (*ecdsa.PublicKey, error) {
+	return publicKeyOf(m.signer)
+}
+
+// Signer returns the signer the MemoryKeyManager was created with
+func (m *MemoryKeyManager) Signer() (crypto.Signer, error) {
+	return m.signer, nil
+}
+
+// KeyID returns the Key ID the MemoryKeyManager was created with
+func (m *MemoryKeyManager) KeyID() (string, error) {
+	return m.keyID, nil
+}
+
+// RemoveSigningIdentity always fails, a MemoryKeyManager can't be changed
+func (m *MemoryKeyManager) RemoveSigningIdentity() error {
+	return ErrReadOnly
+}
+
+// StoreKeyID always fails, a MemoryKeyManager can't be changed
+func (m *MemoryKeyManager) StoreKeyID(key string) error {
+	return ErrReadOnly
+}
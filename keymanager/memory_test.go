@@ -0,0 +1,59 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFromPEM(t *testing.T) {
+	manager, err := NewFromPEM([]byte(fixturePEM(t)), "key id")
+	assert.Nil(t, err)
+
+	fixture := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	expected, _ := fixture.PublicKey()
+	publicKey, err := manager.PublicKey()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, publicKey)
+	keyID, _ := manager.KeyID()
+	assert.Equal(t, "key id", keyID)
+}
+
+func TestNewFromPEMAcceptsDER(t *testing.T) {
+	der, _ := ioutil.ReadFile("./fixtures/test_identity.der")
+	_, err := NewFromPEM(der, "key id")
+	assert.Nil(t, err)
+}
+
+func TestNewFromPEMRejectsInvalidInput(t *testing.T) {
+	_, err := NewFromPEM([]byte("not a key"), "key id")
+	assert.True(t, errors.Is(err, ErrInvalidIdentity))
+
+	_, err = NewFromPEM([]byte(fixturePEM(t)), " ")
+	assert.True(t, errors.Is(err, ErrNoKeyID), "An empty Key ID should be reported up front")
+}
+
+func TestNewFromKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	manager, err := NewFromKey(key, "key id")
+	assert.Nil(t, err)
+
+	signer, _ := manager.Signer()
+	assert.Equal(t, key, signer)
+	assert.True(t, errors.Is(manager.StoreKeyID("other"), ErrReadOnly))
+	assert.True(t, errors.Is(manager.RemoveSigningIdentity(), ErrReadOnly))
+}
+
+func TestNewFromKeyRequiresP256(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, err := NewFromKey(key, "key id")
+	assert.True(t, errors.Is(err, ErrUnsupportedKey))
+
+	_, err = NewFromKey(nil, "key id")
+	assert.True(t, errors.Is(err, ErrNoIdentity))
+}
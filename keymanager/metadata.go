@@ -0,0 +1,144 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/apex/log"
+)
+
+// metadataFileSuffix is appended to the name of the PEM file to get the name of the identity's metadata file
+const metadataFileSuffix = ".json"
+
+// Metadata describes a signing identity, so that it can be matched with the key in the CloudKit Dashboard
+type Metadata struct {
+	// Created is the time the signing identity was created, imported or restored
+	Created time.Time `json:"created"`
+	// Fingerprint is the SHA-256 fingerprint of the identity's public key, see Fingerprint
+	Fingerprint string `json:"fingerprint"`
+	// Container is the CloudKit container the identity is registered for
+	Container string `json:"container,omitempty"`
+	// Environment is the CloudKit environment the identity is registered for, e.g. development or production
+	Environment string `json:"environment,omitempty"`
+	// Note is a free text description
+	Note string `json:"note,omitempty"`
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the DER encoded public key in the form `SHA256:<base64>`
+func Fingerprint(publicKey *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// Metadata returns the metadata stored alongside the signing identity.
+//
+// The fingerprint is always computed from the public key. Identities without a metadata file, e.g. ones created by older versions of sputnik,
+// get their creation time from the PEM file.
+func (c *CloudKitKeyManager) Metadata() (Metadata, error) {
+	publicKey, err := c.PublicKey()
+	if err != nil {
+		return Metadata{}, err
+	}
+	fingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	metadata, err := c.storedMetadata()
+	if os.IsNotExist(err) {
+		metadata = Metadata{Created: c.pemModTime()}
+	} else if err != nil {
+		return Metadata{}, err
+	} else if metadata.Fingerprint != fingerprint {
+		log.Warnf("The metadata in %s belongs to another key (%s)", c.metadataFilePath(), metadata.Fingerprint)
+		metadata = Metadata{Created: c.pemModTime()}
+	}
+
+	metadata.Fingerprint = fingerprint
+	return metadata, nil
+}
+
+// StoreMetadata stores the container, environment and note of the given metadata alongside the signing identity.
+// The creation time and fingerprint are kept.
+func (c *CloudKitKeyManager) StoreMetadata(metadata Metadata) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+
+	current, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current.Container = metadata.Container
+	current.Environment = metadata.Environment
+	current.Note = metadata.Note
+	return c.writeMetadata(current)
+}
+
+// updateMetadata writes the metadata of a newly written private key. Metadata of the same key, e.g. after encrypting it, is kept.
+// The caller needs to hold the lock.
+func (c *CloudKitKeyManager) updateMetadata(privateKey *ecdsa.PrivateKey) error {
+	fingerprint, err := Fingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := c.storedMetadata()
+	if err != nil || metadata.Fingerprint != fingerprint {
+		metadata = Metadata{Created: time.Now().UTC(), Fingerprint: fingerprint}
+	}
+	return c.writeMetadata(metadata)
+}
+
+// writeMetadata replaces the metadata file. The caller needs to hold the lock.
+func (c *CloudKitKeyManager) writeMetadata(metadata Metadata) error {
+	bytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.metadataFilePath(), bytes, secretsFileMode)
+}
+
+func (c *CloudKitKeyManager) storedMetadata() (Metadata, error) {
+	var metadata Metadata
+	bytes, err := ioutil.ReadFile(c.metadataFilePath())
+	if err != nil {
+		return metadata, err
+	}
+	if err := json.Unmarshal(bytes, &metadata); err != nil {
+		return metadata, fmt.Errorf("invalid metadata in %s: %w", c.metadataFilePath(), err)
+	}
+	return metadata, nil
+}
+
+// pemModTime returns the time the PEM file was last written, or the zero time if it isn't stored in the secrets folder
+func (c *CloudKitKeyManager) pemModTime() time.Time {
+	info, err := os.Stat(c.pemFilePath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime().UTC()
+}
+
+// metadataFilePath represents the path to the metadata of the signing identity
+func (c *CloudKitKeyManager) metadataFilePath() string {
+	return c.pemFilePath() + metadataFileSuffix
+}
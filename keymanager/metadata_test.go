@@ -0,0 +1,60 @@
+package keymanager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	publicKey, _ := manager.PublicKey()
+
+	fingerprint, err := Fingerprint(publicKey)
+	assert.Nil(t, err)
+	assert.Regexp(t, "^SHA256:[A-Za-z0-9+/]{43}$", fingerprint)
+}
+
+func TestMetadataWithoutFile(t *testing.T) {
+	manager := NewWithSecretsFolder("./fixtures", "keyid.txt", "eckey.pem")
+	publicKey, _ := manager.PublicKey()
+	expected, _ := Fingerprint(publicKey)
+
+	metadata, err := manager.Metadata()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, metadata.Fingerprint, "Identities without metadata should still have a fingerprint")
+	assert.False(t, metadata.Created.IsZero())
+}
+
+func TestMetadataIsWrittenWithTheIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_, err := os.Stat("./testFiles/eckey.pem.json")
+	assert.Nil(t, err)
+
+	created, _ := manager.Metadata()
+	assert.Nil(t, manager.StoreMetadata(Metadata{Container: "iCloud.com.example", Environment: "development", Note: "CI"}))
+	assert.Nil(t, manager.EncryptSigningIdentity([]byte("secret")))
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	reader.SetPassphraseProvider(func() ([]byte, error) { return []byte("secret"), nil })
+	metadata, _ := reader.Metadata()
+	assert.Equal(t, created.Created, metadata.Created, "Encrypting the identity should keep its metadata")
+	assert.Equal(t, created.Fingerprint, metadata.Fingerprint)
+	assert.Equal(t, "iCloud.com.example", metadata.Container)
+	assert.Equal(t, "development", metadata.Environment)
+	assert.Equal(t, "CI", metadata.Note)
+}
+
+func TestMetadataOfReplacedIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.StoreMetadata(Metadata{Note: "first"})
+	_ = manager.CreateSigningIdentity()
+
+	metadata, _ := manager.Metadata()
+	assert.Empty(t, metadata.Note, "A new key should not inherit the metadata of the key it replaced")
+}
@@ -1,26 +1,25 @@
 package keymanager
 
 import (
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
+
+	"github.com/q231950/sputnik/keymanager/keymanagertest"
 )
 
 type MockKeyManager struct {
 }
 
-func (m MockKeyManager) PublicKey() *ecdsa.PublicKey {
-	return nil
+func (m MockKeyManager) PublicKey() (*ecdsa.PublicKey, error) {
+	return &keymanagertest.Key().PublicKey, nil
 }
 
-func (m MockKeyManager) PrivateKey() *ecdsa.PrivateKey {
-	c := elliptic.P256()
-	key, _ := ecdsa.GenerateKey(c, rand.Reader)
-	return key
+func (m MockKeyManager) Signer() (crypto.Signer, error) {
+	return keymanagertest.DeterministicSigner{Key: keymanagertest.Key()}, nil
 }
 
-func (m MockKeyManager) KeyID() string {
-	return "key id"
+func (m MockKeyManager) KeyID() (string, error) {
+	return "key id", nil
 }
 
 func (m MockKeyManager) RemoveSigningIdentity() error {
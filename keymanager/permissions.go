@@ -0,0 +1,145 @@
+package keymanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/apex/log"
+)
+
+const (
+	// secretsFolderMode is the mode of the secrets folder and the profile folders in it
+	secretsFolderMode = os.FileMode(0700)
+	// secretsFileMode is the mode of every file in the secrets folder
+	secretsFileMode = os.FileMode(0600)
+	// legacyFileMode is the mode earlier versions of sputnik wrote the private key and the Key ID with
+	legacyFileMode = os.FileMode(0644)
+)
+
+// A PermissionProblem describes a file or folder in the secrets folder that other local users can access
+type PermissionProblem struct {
+	Path string
+	// Mode is the current mode of the file or folder
+	Mode os.FileMode
+	// Expected is the mode the file or folder should have
+	Expected os.FileMode
+	// ForeignOwner is true when the file or folder doesn't belong to the current user. This can't be repaired by FixPermissions.
+	ForeignOwner bool
+}
+
+func (p PermissionProblem) String() string {
+	if p.ForeignOwner {
+		return fmt.Sprintf("%s is owned by another user", p.Path)
+	}
+	return fmt.Sprintf("%s has mode %04o instead of %04o", p.Path, p.Mode.Perm(), p.Expected)
+}
+
+// severe tells whether the problem allows any user to change the file, not just to read it.
+// Group write access alone isn't severe, because checkouts made with a umask of 002 have it.
+func (p PermissionProblem) severe() bool {
+	return p.ForeignOwner || p.Mode.Perm()&0002 != 0
+}
+
+// severeForSecret tells whether the problem gives anyone but the owner access to a private key or Key ID file.
+// Unlike for folders, reading is enough: a readable private key can be copied and used to sign requests.
+func (p PermissionProblem) severeForSecret() bool {
+	return p.ForeignOwner || p.Mode.Perm()&0077 != 0
+}
+
+// legacy tells whether the file still has the mode earlier versions of sputnik wrote secrets with.
+// Those are only warned about, so that an upgrade doesn't break signing before `sputnik identity fix-permissions` was run.
+func (p PermissionProblem) legacy() bool {
+	return !p.ForeignOwner && p.Mode.Perm() == legacyFileMode
+}
+
+// CheckPermissions lists the files and folders in the secrets folder that are accessible to other users or owned by another user
+func CheckPermissions(secretsFolder string) ([]PermissionProblem, error) {
+	problems := []PermissionProblem{}
+	err := filepath.Walk(secretsFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if problem, ok := permissionProblem(path, info); ok {
+			problems = append(problems, problem)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return problems, nil
+	}
+	return problems, err
+}
+
+// FixPermissions restricts every file in the secrets folder to 0600 and every folder to 0700 and returns the problems it repaired.
+//
+// Files owned by another user are reported with ErrInsecurePermissions, because only their owner can repair them.
+func FixPermissions(secretsFolder string) ([]PermissionProblem, error) {
+	problems, err := CheckPermissions(secretsFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	fixed := []PermissionProblem{}
+	for _, problem := range problems {
+		if problem.ForeignOwner {
+			return fixed, fmt.Errorf("%w: %s", ErrInsecurePermissions, problem)
+		}
+		if err := os.Chmod(problem.Path, problem.Expected); err != nil {
+			return fixed, err
+		}
+		fixed = append(fixed, problem)
+	}
+	return fixed, nil
+}
+
+// verifyPermissions checks the folders of the secrets folder and the secrets in it before they are loaded.
+//
+// Secrets that any other user can access are refused, unless they still have the mode earlier versions wrote them with.
+// A folder is only refused if every user can change it, other problems are logged.
+func verifyPermissions(folders []string, secrets ...string) error {
+	for _, folder := range folders {
+		if problem, ok := statPermissions(folder); ok {
+			if problem.severe() {
+				return fmt.Errorf("%w: %s, run `sputnik identity fix-permissions`", ErrInsecurePermissions, problem)
+			}
+			log.Warnf("%s, run `sputnik identity fix-permissions`", problem)
+		}
+	}
+
+	for _, path := range secrets {
+		problem, ok := statPermissions(path)
+		if !ok {
+			continue
+		}
+		if problem.legacy() {
+			log.Warnf("%s, other users can read it, run `sputnik identity fix-permissions`", problem)
+		} else if problem.severeForSecret() {
+			return fmt.Errorf("%w: %s, run `sputnik identity fix-permissions`", ErrInsecurePermissions, problem)
+		}
+	}
+	return nil
+}
+
+// statPermissions returns the permission problem of the file or folder, if it exists and has one
+func statPermissions(path string) (PermissionProblem, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return PermissionProblem{}, false
+	}
+	return permissionProblem(path, info)
+}
+
+func permissionProblem(path string, info os.FileInfo) (PermissionProblem, bool) {
+	if !permissionsEnforced {
+		return PermissionProblem{}, false
+	}
+
+	expected := secretsFileMode
+	if info.IsDir() {
+		expected = secretsFolderMode
+	}
+
+	problem := PermissionProblem{Path: path, Mode: info.Mode(), Expected: expected, ForeignOwner: !ownedByCurrentUser(info)}
+	return problem, problem.ForeignOwner || info.Mode().Perm()&0077 != 0
+}
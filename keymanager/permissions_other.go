@@ -0,0 +1,13 @@
+//go:build !unix
+
+package keymanager
+
+import "os"
+
+// permissionsEnforced tells whether the modes and owners of secrets are checked. Unix file modes don't apply on this platform.
+const permissionsEnforced = false
+
+// ownedByCurrentUser tells whether the file belongs to the user running sputnik
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
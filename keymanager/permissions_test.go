@@ -0,0 +1,113 @@
+//go:build unix
+
+package keymanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretsAreCreatedPrivate(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.StoreKeyID("key")
+
+	problems, err := CheckPermissions("./testFiles")
+	assert.Nil(t, err)
+	assert.Empty(t, problems, "New secrets should only be accessible to their owner")
+}
+
+func TestCheckAndFixPermissions(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = os.Chmod("./testFiles", 0755)
+	_ = os.Chmod("./testFiles/eckey.pem", 0644)
+
+	problems, _ := CheckPermissions("./testFiles")
+	assert.Equal(t, 2, len(problems))
+
+	fixed, err := FixPermissions("./testFiles")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(fixed))
+
+	info, _ := os.Stat("./testFiles/eckey.pem")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	problems, _ = CheckPermissions("./testFiles")
+	assert.Empty(t, problems)
+}
+
+func TestWritablePrivateKeyIsRefused(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+	_ = os.Chmod("./testFiles/eckey.pem", 0666)
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := manager.PrivateKey()
+	assert.True(t, errors.Is(err, ErrInsecurePermissions), "A private key every user can change must not be used")
+}
+
+func TestReadablePrivateKeyIsRefused(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+	_ = os.Chmod("./testFiles/eckey.pem", 0640)
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := manager.PrivateKey()
+	assert.True(t, errors.Is(err, ErrInsecurePermissions), "A private key other users can read could be copied")
+}
+
+func TestReadableKeyIDIsRefused(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+	_ = writer.StoreKeyID("key")
+	_ = os.Chmod("./testFiles/keyid.txt", 0640)
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := manager.KeyID()
+	assert.True(t, errors.Is(err, ErrInsecurePermissions))
+}
+
+func TestReadableSecretsFolderIsUsed(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+	_ = os.Chmod("./testFiles", 0755)
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := manager.PrivateKey()
+	assert.Nil(t, err, "Secrets folders other users can list should only be warned about")
+}
+
+func TestLegacyModeIsOnlyWarnedAbout(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+	_ = writer.StoreKeyID("key")
+	_ = os.Chmod("./testFiles/eckey.pem", 0644)
+	_ = os.Chmod("./testFiles/keyid.txt", 0644)
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := manager.PrivateKey()
+	assert.Nil(t, err, "Secrets written by earlier versions should keep working until the permissions are fixed")
+	_, err = manager.KeyID()
+	assert.Nil(t, err)
+}
+
+func TestWritableSecretsFolderOfProfileIsRefused(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	writer, _ := NewWithProfileInSecretsFolder("./testFiles", "work")
+	_ = writer.CreateSigningIdentity()
+	_ = os.Chmod("./testFiles", 0777)
+
+	manager, _ := NewWithProfileInSecretsFolder("./testFiles", "work")
+	_, err := manager.PrivateKey()
+	assert.True(t, errors.Is(err, ErrInsecurePermissions), "The secrets folder a profile is nested in should be checked too")
+}
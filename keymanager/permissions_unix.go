@@ -0,0 +1,20 @@
+//go:build unix
+
+package keymanager
+
+import (
+	"os"
+	"syscall"
+)
+
+// permissionsEnforced tells whether the modes and owners of secrets are checked
+const permissionsEnforced = true
+
+// ownedByCurrentUser tells whether the file belongs to the user running sputnik
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	return int(stat.Uid) == os.Getuid()
+}
@@ -0,0 +1,311 @@
+//go:build cgo
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/q231950/sputnik/keymanager"
+)
+
+// KeyManager is a keymanager.KeyManagerV2 that signs with a key pair in a PKCS#11 token.
+//
+// PrivateKey always fails with keymanager.ErrNotExportable, signing goes through Signer. Close the KeyManager when done.
+type KeyManager struct {
+	config    Config
+	ctx       *p11.Ctx
+	session   p11.SessionHandle
+	key       p11.ObjectHandle
+	publicKey *ecdsa.PublicKey
+	mutex     sync.Mutex
+}
+
+// New opens a session with the configured token and looks up the key pair
+func New(config Config) (*KeyManager, error) {
+	ctx, session, err := openSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &KeyManager{config: config, ctx: ctx, session: session}
+	if err := manager.findKeyPair(); err != nil {
+		manager.Close()
+		return nil, err
+	}
+	return manager, nil
+}
+
+// GenerateKey creates a P-256 key pair inside the configured token and returns its public key for the CloudKit Dashboard.
+// The private key is created non-extractable. Both keys share a random CKA_ID, so that they can be told apart from other pairs.
+//
+// A label that is already used by a key in the token is refused with ErrKeyExists.
+func GenerateKey(config Config) (*ecdsa.PublicKey, error) {
+	ctx, session, err := openSession(config)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSession(ctx, session)
+
+	label := config.keyLabel()
+	for _, class := range []uint{p11.CKO_PRIVATE_KEY, p11.CKO_PUBLIC_KEY} {
+		existing, err := findObjects(ctx, session, class, label)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("%w: `%s`", ErrKeyExists, label)
+		}
+	}
+
+	id := make([]byte, keyIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	publicTemplate := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_TOKEN, true),
+		p11.NewAttribute(p11.CKA_VERIFY, true),
+		p11.NewAttribute(p11.CKA_EC_PARAMS, ecParamsP256()),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+		p11.NewAttribute(p11.CKA_ID, id),
+	}
+	privateTemplate := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_TOKEN, true),
+		p11.NewAttribute(p11.CKA_PRIVATE, true),
+		p11.NewAttribute(p11.CKA_SIGN, true),
+		p11.NewAttribute(p11.CKA_SENSITIVE, true),
+		p11.NewAttribute(p11.CKA_EXTRACTABLE, false),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+		p11.NewAttribute(p11.CKA_ID, id),
+	}
+
+	mechanism := []*p11.Mechanism{p11.NewMechanism(p11.CKM_EC_KEY_PAIR_GEN, nil)}
+	publicHandle, _, err := ctx.GenerateKeyPair(session, mechanism, publicTemplate, privateTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the key pair in the token: %w", err)
+	}
+
+	return readPublicKey(ctx, session, publicHandle)
+}
+
+// PublicKey returns the public key of the key pair
+func (k *KeyManager) PublicKey() (*ecdsa.PublicKey, error) {
+	return k.publicKey, nil
+}
+
+// PrivateKey always fails, the private key can't leave the token
+func (k *KeyManager) PrivateKey() (*ecdsa.PrivateKey, error) {
+	return nil, keymanager.ErrNotExportable
+}
+
+// Signer returns the KeyManager itself, which signs inside the token
+func (k *KeyManager) Signer() (crypto.Signer, error) {
+	return k, nil
+}
+
+// Public implements crypto.Signer
+func (k *KeyManager) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign implements crypto.Signer. The digest is signed with CKM_ECDSA inside the token, rand is ignored.
+func (k *KeyManager) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.ctx == nil {
+		return nil, ErrClosed
+	}
+
+	mechanism := []*p11.Mechanism{p11.NewMechanism(p11.CKM_ECDSA, nil)}
+	if err := k.ctx.SignInit(k.session, mechanism, k.key); err != nil {
+		return nil, fmt.Errorf("failed to start signing in the token: %w", err)
+	}
+
+	raw, err := k.ctx.Sign(k.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign in the token: %w", err)
+	}
+	return asn1Signature(raw)
+}
+
+// KeyID returns the CloudKit Key ID from the Config
+func (k *KeyManager) KeyID() (string, error) {
+	if len(k.config.KeyID) == 0 {
+		return "", keymanager.ErrNoKeyID
+	}
+	return k.config.KeyID, nil
+}
+
+// RemoveSigningIdentity always fails, keys in a token are managed with the token's own tools
+func (k *KeyManager) RemoveSigningIdentity() error {
+	return keymanager.ErrReadOnly
+}
+
+// StoreKeyID always fails, pass the Key ID in the Config instead
+func (k *KeyManager) StoreKeyID(key string) error {
+	return keymanager.ErrReadOnly
+}
+
+// Close logs out of the token and unloads the PKCS#11 module
+func (k *KeyManager) Close() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.ctx == nil {
+		return nil
+	}
+	err := closeSession(k.ctx, k.session)
+	k.ctx = nil
+	return err
+}
+
+// findKeyPair looks up the private key with the configured label and the public key that shares its CKA_ID.
+// Keys without CKA_ID, e.g. ones created with other tools, are paired by label alone. More than one match is refused with ErrAmbiguousKey.
+func (k *KeyManager) findKeyPair() error {
+	label := k.config.keyLabel()
+
+	privateKey, err := findOne(k.ctx, k.session, p11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return err
+	}
+
+	attributes, err := k.ctx.GetAttributeValue(k.session, privateKey, []*p11.Attribute{p11.NewAttribute(p11.CKA_ID, nil)})
+	if err != nil {
+		return fmt.Errorf("failed to read the key's CKA_ID from the token: %w", err)
+	}
+	var id []*p11.Attribute
+	if len(attributes) > 0 && len(attributes[0].Value) > 0 {
+		id = []*p11.Attribute{p11.NewAttribute(p11.CKA_ID, attributes[0].Value)}
+	}
+
+	publicKeyHandle, err := findOne(k.ctx, k.session, p11.CKO_PUBLIC_KEY, label, id...)
+	if err != nil {
+		return err
+	}
+	publicKey, err := readPublicKey(k.ctx, k.session, publicKeyHandle)
+	if err != nil {
+		return err
+	}
+
+	k.key = privateKey
+	k.publicKey = publicKey
+	return nil
+}
+
+// findOne returns the only EC key of the class with the label and the extra attributes
+func findOne(ctx *p11.Ctx, session p11.SessionHandle, class uint, label string, extra ...*p11.Attribute) (p11.ObjectHandle, error) {
+	objects, err := findObjects(ctx, session, class, label, extra...)
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("%w: `%s`", ErrKeyNotFound, label)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("%w: `%s`", ErrAmbiguousKey, label)
+	}
+}
+
+func openSession(config Config) (*p11.Ctx, p11.SessionHandle, error) {
+	ctx := p11.New(config.Module)
+	if ctx == nil {
+		return nil, 0, fmt.Errorf("failed to load the PKCS#11 module `%s`", config.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, 0, fmt.Errorf("failed to initialize the PKCS#11 module: %w", err)
+	}
+
+	slot, err := findSlot(ctx, config.TokenLabel)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, 0, err
+	}
+
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, 0, fmt.Errorf("failed to open a session with the token: %w", err)
+	}
+
+	if err := ctx.Login(session, p11.CKU_USER, config.PIN); err != nil {
+		closeSession(ctx, session)
+		return nil, 0, fmt.Errorf("failed to log in to the token: %w", err)
+	}
+	return ctx, session, nil
+}
+
+func closeSession(ctx *p11.Ctx, session p11.SessionHandle) error {
+	ctx.Logout(session)
+	err := ctx.CloseSession(session)
+	ctx.Finalize()
+	ctx.Destroy()
+	return err
+}
+
+func findSlot(ctx *p11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the token slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(info.Label) == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no token with label `%s`", tokenLabel)
+}
+
+func findObjects(ctx *p11.Ctx, session p11.SessionHandle, class uint, label string, extra ...*p11.Attribute) ([]p11.ObjectHandle, error) {
+	template := append([]*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, class),
+		p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_EC),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+	}, extra...)
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return nil, err
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	objects, _, err := ctx.FindObjects(session, 2)
+	return objects, err
+}
+
+func readPublicKey(ctx *p11.Ctx, session p11.SessionHandle, handle p11.ObjectHandle) (*ecdsa.PublicKey, error) {
+	attributes, err := ctx.GetAttributeValue(session, handle, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+		p11.NewAttribute(p11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the public key from the token: %w", err)
+	}
+
+	var ecParams, ecPoint []byte
+	for _, attribute := range attributes {
+		switch attribute.Type {
+		case p11.CKA_EC_PARAMS:
+			ecParams = attribute.Value
+		case p11.CKA_EC_POINT:
+			ecPoint = attribute.Value
+		}
+	}
+	return publicKeyFromAttributes(ecParams, ecPoint)
+}
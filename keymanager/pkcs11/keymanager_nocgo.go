@@ -0,0 +1,67 @@
+//go:build !cgo
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"io"
+)
+
+// KeyManager is unavailable in builds without cgo, New always returns ErrUnsupported
+type KeyManager struct{}
+
+// New always fails with ErrUnsupported in builds without cgo
+func New(config Config) (*KeyManager, error) {
+	return nil, ErrUnsupported
+}
+
+// GenerateKey always fails with ErrUnsupported in builds without cgo
+func GenerateKey(config Config) (*ecdsa.PublicKey, error) {
+	return nil, ErrUnsupported
+}
+
+// PublicKey always fails with ErrUnsupported
+func (k *KeyManager) PublicKey() (*ecdsa.PublicKey, error) {
+	return nil, ErrUnsupported
+}
+
+// PrivateKey always fails with ErrUnsupported
+func (k *KeyManager) PrivateKey() (*ecdsa.PrivateKey, error) {
+	return nil, ErrUnsupported
+}
+
+// Signer always fails with ErrUnsupported
+func (k *KeyManager) Signer() (crypto.Signer, error) {
+	return nil, ErrUnsupported
+}
+
+// Public implements crypto.Signer
+func (k *KeyManager) Public() crypto.PublicKey {
+	return nil
+}
+
+// Sign always fails with ErrUnsupported
+func (k *KeyManager) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// KeyID always fails with ErrUnsupported
+func (k *KeyManager) KeyID() (string, error) {
+	return "", ErrUnsupported
+}
+
+// RemoveSigningIdentity always fails with ErrUnsupported
+func (k *KeyManager) RemoveSigningIdentity() error {
+	return ErrUnsupported
+}
+
+// StoreKeyID always fails with ErrUnsupported
+func (k *KeyManager) StoreKeyID(key string) error {
+	return ErrUnsupported
+}
+
+// Close does nothing
+func (k *KeyManager) Close() error {
+	return nil
+}
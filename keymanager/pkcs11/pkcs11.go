@@ -0,0 +1,110 @@
+/*
+Package pkcs11 offers a KeyManager that signs CloudKit requests with a P-256 key kept in a PKCS#11 token, e.g. an HSM.
+
+The private key never leaves the token. Use SoftHSM to try it locally:
+
+	softhsm2-util --init-token --free --label sputnik --pin 1234 --so-pin 1234
+	SPUTNIK_PKCS11_PIN=1234 sputnik identity create --pkcs11 --pkcs11-module /usr/lib/softhsm/libsofthsm2.so --pkcs11-token sputnik
+*/
+package pkcs11
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PINEnvironmentVariableName is the environment variable that holds the user PIN of the token
+const PINEnvironmentVariableName = string("SPUTNIK_PKCS11_PIN")
+
+// DefaultKeyLabel is the label of the key pair when Config doesn't name one
+const DefaultKeyLabel = "sputnik-cloudkit"
+
+// keyIDLength is the length of the random CKA_ID that ties the keys of a generated pair together
+const keyIDLength = 16
+
+// ErrKeyNotFound is returned when the token has no key pair with the configured label
+var ErrKeyNotFound = errors.New("no key pair with this label in the token")
+
+// ErrKeyExists is returned when a key pair would be generated with a label that a key in the token already has
+var ErrKeyExists = errors.New("the token already has a key with this label")
+
+// ErrAmbiguousKey is returned when more than one key in the token matches the configured label, so that the key pair can't be told apart
+var ErrAmbiguousKey = errors.New("more than one key with this label in the token")
+
+// ErrClosed is returned when a KeyManager is used after Close
+var ErrClosed = errors.New("the PKCS#11 session is closed")
+
+// ErrUnsupported is returned when sputnik was built without cgo, which the PKCS#11 bindings need
+var ErrUnsupported = errors.New("PKCS#11 support requires a build with cgo enabled")
+
+// Config describes where to find the signing key
+type Config struct {
+	// Module is the path to the PKCS#11 library of the token, e.g. /usr/lib/softhsm/libsofthsm2.so
+	Module string
+	// TokenLabel selects the token. The first token with a matching label is used.
+	TokenLabel string
+	// PIN is the user PIN of the token
+	PIN string
+	// KeyLabel is the label of the key pair in the token, DefaultKeyLabel if empty
+	KeyLabel string
+	// KeyID is the CloudKit Key ID that belongs to the key pair. Tokens don't store it, so it is passed in.
+	KeyID string
+}
+
+func (c Config) keyLabel() string {
+	if len(c.KeyLabel) == 0 {
+		return DefaultKeyLabel
+	}
+	return c.KeyLabel
+}
+
+// oidNamedCurveP256 is the ASN.1 object identifier of prime256v1, the value of CKA_EC_PARAMS for P-256 keys
+var oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+// ecParamsP256 returns the DER encoded CKA_EC_PARAMS of a P-256 key
+func ecParamsP256() []byte {
+	params, _ := asn1.Marshal(oidNamedCurveP256)
+	return params
+}
+
+// publicKeyFromAttributes builds the public key from the CKA_EC_PARAMS and CKA_EC_POINT attributes of a token object
+func publicKeyFromAttributes(ecParams []byte, ecPoint []byte) (*ecdsa.PublicKey, error) {
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(ecParams, &curve); err != nil {
+		return nil, fmt.Errorf("malformed CKA_EC_PARAMS: %w", err)
+	}
+	if !curve.Equal(oidNamedCurveP256) {
+		return nil, fmt.Errorf("the key uses curve %s, CloudKit requires P-256", curve)
+	}
+
+	// CKA_EC_POINT is an uncompressed point wrapped in a DER OCTET STRING
+	var point []byte
+	if _, err := asn1.Unmarshal(ecPoint, &point); err != nil {
+		return nil, fmt.Errorf("malformed CKA_EC_POINT: %w", err)
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		return nil, errors.New("CKA_EC_POINT is not a point on P-256")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// asn1Signature converts the r||s signature CKM_ECDSA produces into the ASN.1 DER form crypto.Signer returns
+func asn1Signature(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, fmt.Errorf("unexpected ECDSA signature length %d", len(raw))
+	}
+
+	half := len(raw) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(raw[:half]),
+		S: new(big.Int).SetBytes(raw[half:]),
+	})
+}
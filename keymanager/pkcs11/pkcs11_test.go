@@ -0,0 +1,46 @@
+package pkcs11
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestASN1Signature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	digest := sha256.Sum256([]byte("message"))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	s.FillBytes(raw[32:])
+
+	signature, err := asn1Signature(raw)
+	assert.Nil(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature), "The converted signature should verify like one from crypto/ecdsa")
+}
+
+func TestASN1SignatureRejectsOddLength(t *testing.T) {
+	_, err := asn1Signature([]byte{1, 2, 3})
+	assert.NotNil(t, err)
+}
+
+func TestPublicKeyFromAttributes(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	point, _ := asn1.Marshal(elliptic.Marshal(elliptic.P256(), key.X, key.Y))
+
+	publicKey, err := publicKeyFromAttributes(ecParamsP256(), point)
+	assert.Nil(t, err)
+	assert.True(t, key.PublicKey.Equal(publicKey))
+}
+
+func TestPublicKeyFromAttributesRejectsOtherCurves(t *testing.T) {
+	secp384r1, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 132, 0, 34})
+	_, err := publicKeyFromAttributes(secp384r1, nil)
+	assert.NotNil(t, err, "CloudKit only accepts P-256 keys")
+}
@@ -0,0 +1,96 @@
+//go:build cgo
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/q231950/sputnik/keymanager"
+	"github.com/stretchr/testify/assert"
+)
+
+// softHSMConfig returns the token to test against. Initialise one with
+//
+//	softhsm2-util --init-token --free --label sputnik-test --pin 1234 --so-pin 1234
+//
+// and run the tests with SPUTNIK_TEST_PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so SPUTNIK_TEST_PKCS11_TOKEN=sputnik-test SPUTNIK_TEST_PKCS11_PIN=1234
+func softHSMConfig(t *testing.T) Config {
+	module := os.Getenv("SPUTNIK_TEST_PKCS11_MODULE")
+	if len(module) == 0 {
+		t.Skip("SPUTNIK_TEST_PKCS11_MODULE is not set")
+	}
+
+	return Config{
+		Module:     module,
+		TokenLabel: os.Getenv("SPUTNIK_TEST_PKCS11_TOKEN"),
+		PIN:        os.Getenv("SPUTNIK_TEST_PKCS11_PIN"),
+		KeyLabel:   fmt.Sprintf("sputnik-test-%s-%d", t.Name(), time.Now().UnixNano()),
+		KeyID:      "key id",
+	}
+}
+
+func TestSignInToken(t *testing.T) {
+	config := softHSMConfig(t)
+
+	generated, err := GenerateKey(config)
+	assert.Nil(t, err)
+
+	manager, err := New(config)
+	assert.Nil(t, err)
+	defer manager.Close()
+
+	publicKey, _ := manager.PublicKey()
+	assert.True(t, generated.Equal(publicKey))
+
+	_, err = manager.PrivateKey()
+	assert.True(t, errors.Is(err, keymanager.ErrNotExportable), "The private key must not leave the token")
+
+	digest := sha256.Sum256([]byte("message"))
+	signer, _ := manager.Signer()
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.Nil(t, err)
+	assert.True(t, ecdsa.VerifyASN1(publicKey, digest[:], signature))
+}
+
+func TestMissingKeyInToken(t *testing.T) {
+	config := softHSMConfig(t)
+	config.KeyLabel = "missing"
+
+	_, err := New(config)
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestGenerateKeyRefusesExistingLabel(t *testing.T) {
+	config := softHSMConfig(t)
+
+	_, err := GenerateKey(config)
+	assert.Nil(t, err)
+
+	_, err = GenerateKey(config)
+	assert.True(t, errors.Is(err, ErrKeyExists), "A second key pair with the same label couldn't be told apart from the first")
+
+	manager, err := New(config)
+	assert.Nil(t, err)
+	manager.Close()
+}
+
+func TestSignAfterClose(t *testing.T) {
+	config := softHSMConfig(t)
+	GenerateKey(config)
+
+	manager, err := New(config)
+	assert.Nil(t, err)
+	manager.Close()
+
+	digest := sha256.Sum256([]byte("message"))
+	_, err = manager.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.True(t, errors.Is(err, ErrClosed))
+}
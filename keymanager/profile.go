@@ -0,0 +1,146 @@
+package keymanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the name of the profile whose signing identity lives directly in the secrets folder
+const DefaultProfile = "default"
+
+const (
+	// profilesFolderName is the folder in the secrets folder that holds one folder per named profile
+	profilesFolderName = "profiles"
+	// activeProfileFileName is the file in the secrets folder that holds the name of the profile `identity use` selected
+	activeProfileFileName = "active-profile"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// NewWithProfile returns a CloudKitKeyManager for the named profile in the default secrets folder.
+//
+// When SPUTNIK_CLOUDKIT_PRIVATE_KEY or SPUTNIK_CLOUDKIT_PRIVATE_KEY_FILE is set, the private key is read from the environment instead.
+func NewWithProfile(profile string) (CloudKitKeyManager, error) {
+	secretsFolder, err := DefaultSecretsFolder()
+	if err != nil {
+		return CloudKitKeyManager{}, err
+	}
+	return NewInSecretsFolder(secretsFolder, profile)
+}
+
+// NewInSecretsFolder returns a CloudKitKeyManager for the named profile in the given secrets folder.
+// Without a name, the active profile of the secrets folder is used.
+//
+// Like New and NewWithProfile, it reads the private key from the environment when SPUTNIK_CLOUDKIT_PRIVATE_KEY or SPUTNIK_CLOUDKIT_PRIVATE_KEY_FILE is set.
+func NewInSecretsFolder(secretsFolder string, profile string) (CloudKitKeyManager, error) {
+	if len(profile) == 0 {
+		active, err := ActiveProfile(secretsFolder)
+		if err != nil {
+			return CloudKitKeyManager{}, err
+		}
+		profile = active
+	}
+
+	manager, err := NewWithProfileInSecretsFolder(secretsFolder, profile)
+	if err == nil && EnvironmentKeyConfigured() {
+		manager.environment = NewEnvironmentKeyManager()
+	}
+	return manager, err
+}
+
+// NewWithProfileInSecretsFolder returns a CloudKitKeyManager for the named profile in a specific secrets folder
+func NewWithProfileInSecretsFolder(secretsFolder string, profile string) (CloudKitKeyManager, error) {
+	if err := ValidateProfileName(profile); err != nil {
+		return CloudKitKeyManager{}, err
+	}
+
+	manager := NewWithSecretsFolder(ProfileFolder(secretsFolder, profile), defaultKeyIDFileName, defaultPemFileName)
+	manager.profile = profile
+	return manager, nil
+}
+
+// ValidateProfileName checks that the given name can be used as a profile name.
+//
+// Profile names must start with a letter or digit and may only contain letters, digits, '.', '_' and '-'.
+func ValidateProfileName(profile string) error {
+	if !profileNamePattern.MatchString(profile) {
+		return fmt.Errorf("%w: `%s`", ErrInvalidProfileName, profile)
+	}
+	return nil
+}
+
+// ProfileFolder returns the folder the signing identity of the given profile is stored in.
+//
+// The default profile uses the secrets folder itself, so that identities created before profiles existed keep working.
+func ProfileFolder(secretsFolder string, profile string) string {
+	if profile == DefaultProfile {
+		return secretsFolder
+	}
+	return strings.Join([]string{secretsFolder, profilesFolderName, profile}, "/")
+}
+
+// Profiles returns the names of all profiles in the given secrets folder, sorted by name.
+//
+// The default profile is always part of the result.
+func Profiles(secretsFolder string) ([]string, error) {
+	profiles := []string{}
+
+	entries, err := ioutil.ReadDir(strings.Join([]string{secretsFolder, profilesFolderName}, "/"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != DefaultProfile && ValidateProfileName(entry.Name()) == nil {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+	sort.Strings(profiles)
+
+	return append([]string{DefaultProfile}, profiles...), nil
+}
+
+// ActiveProfile returns the profile that was selected with UseProfile, or DefaultProfile when none was selected
+func ActiveProfile(secretsFolder string) (string, error) {
+	bytes, err := ioutil.ReadFile(activeProfilePath(secretsFolder))
+	if os.IsNotExist(err) {
+		return DefaultProfile, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	profile := strings.TrimSpace(string(bytes))
+	if len(profile) == 0 {
+		return DefaultProfile, nil
+	}
+	return profile, ValidateProfileName(profile)
+}
+
+// UseProfile makes the given profile the active one. Named profiles need to exist before they can be used.
+func UseProfile(secretsFolder string, profile string) error {
+	if err := ValidateProfileName(profile); err != nil {
+		return err
+	}
+
+	if profile != DefaultProfile {
+		info, err := os.Stat(ProfileFolder(secretsFolder, profile))
+		if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+			return fmt.Errorf("%w: `%s`", ErrNoProfile, profile)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if _, err := createSecretsFolder(secretsFolder); err != nil {
+		return err
+	}
+	return writeFileAtomic(activeProfilePath(secretsFolder), []byte(profile+"\n"), secretsFileMode)
+}
+
+func activeProfilePath(secretsFolder string) string {
+	return secretsFolder + "/" + activeProfileFileName
+}
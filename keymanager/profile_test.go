@@ -0,0 +1,119 @@
+package keymanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultProfileUsesSecretsFolder(t *testing.T) {
+	manager, err := NewWithProfileInSecretsFolder("./fixtures", DefaultProfile)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultProfile, manager.Profile())
+
+	keyID, _ := manager.KeyID()
+	assert.Equal(t, "abc\n", keyID, "The default profile should read the identity that lives directly in the secrets folder")
+}
+
+func TestSecretsFolderFromEnvironment(t *testing.T) {
+	t.Setenv(SecretsFolderEnvironmentVariableName, "./testSecrets")
+	secretsFolder, _ := DefaultSecretsFolder()
+	assert.Equal(t, "./testSecrets", secretsFolder)
+}
+
+func TestSecretsFolderInXDGConfigHome(t *testing.T) {
+	t.Setenv(SecretsFolderEnvironmentVariableName, "")
+	t.Setenv("HOME", "./testHome")
+	t.Setenv("XDG_CONFIG_HOME", "./testConfig")
+	secretsFolder, _ := DefaultSecretsFolder()
+	assert.Equal(t, "testConfig/sputnik/secrets", secretsFolder)
+
+	defer os.RemoveAll("./testHome")
+	assert.Nil(t, os.MkdirAll("./testHome/.sputnik/secrets", 0700))
+	secretsFolder, _ = DefaultSecretsFolder()
+	assert.Equal(t, "testHome/.sputnik/secrets", secretsFolder, "An existing secrets folder in the home directory should keep being used")
+}
+
+func TestNoSecretsFolderWithoutHome(t *testing.T) {
+	t.Setenv(SecretsFolderEnvironmentVariableName, "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "")
+
+	_, err := DefaultSecretsFolder()
+	assert.True(t, errors.Is(err, ErrNoSecretsFolder), "Without a home directory, the secrets folder must not become a relative path")
+
+	t.Setenv("XDG_CONFIG_HOME", "./testConfig")
+	secretsFolder, err := DefaultSecretsFolder()
+	assert.Nil(t, err)
+	assert.Equal(t, "testConfig/sputnik/secrets", secretsFolder)
+}
+
+func TestNewInSecretsFolderUsesActiveProfile(t *testing.T) {
+	secretsFolder := "./testProfiles"
+	defer os.RemoveAll(secretsFolder)
+
+	staging, _ := NewWithProfileInSecretsFolder(secretsFolder, "staging")
+	assert.Nil(t, staging.StoreKeyID("staging key id"))
+	assert.Nil(t, UseProfile(secretsFolder, "staging"))
+
+	manager, err := NewInSecretsFolder(secretsFolder, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "staging", manager.Profile())
+}
+
+func TestNamedProfileFolder(t *testing.T) {
+	assert.Equal(t, "secrets/profiles/production", ProfileFolder("secrets", "production"))
+}
+
+func TestInvalidProfileNames(t *testing.T) {
+	for _, name := range []string{"", "../other", "a/b", ".hidden"} {
+		_, err := NewWithProfileInSecretsFolder("./testProfiles", name)
+		assert.True(t, errors.Is(err, ErrInvalidProfileName), "`%s` should not be accepted as a profile name", name)
+	}
+}
+
+func TestProfilesAndActiveProfile(t *testing.T) {
+	secretsFolder := "./testProfiles"
+	defer os.RemoveAll(secretsFolder)
+
+	staging, _ := NewWithProfileInSecretsFolder(secretsFolder, "staging")
+	assert.Nil(t, staging.CreateSigningIdentity())
+	production, _ := NewWithProfileInSecretsFolder(secretsFolder, "production")
+	assert.Nil(t, production.StoreKeyID("production key id"))
+
+	profiles, err := Profiles(secretsFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{DefaultProfile, "production", "staging"}, profiles)
+
+	active, err := ActiveProfile(secretsFolder)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultProfile, active, "The default profile should be active until another one is used")
+
+	assert.Nil(t, UseProfile(secretsFolder, "production"))
+	active, _ = ActiveProfile(secretsFolder)
+	assert.Equal(t, "production", active)
+}
+
+func TestUseMissingProfile(t *testing.T) {
+	secretsFolder := "./testProfiles"
+	defer os.RemoveAll(secretsFolder)
+
+	err := UseProfile(secretsFolder, "missing")
+	assert.True(t, errors.Is(err, ErrNoProfile), "Only existing profiles should be usable")
+}
+
+func TestProfilesKeepIdentitiesApart(t *testing.T) {
+	secretsFolder := "./testProfiles"
+	defer os.RemoveAll(secretsFolder)
+
+	first, _ := NewWithProfileInSecretsFolder(secretsFolder, "first")
+	second, _ := NewWithProfileInSecretsFolder(secretsFolder, "second")
+	_ = first.CreateSigningIdentity()
+	_ = second.CreateSigningIdentity()
+
+	firstKey, _ := first.PrivateKey()
+	secondKey, _ := second.PrivateKey()
+	assert.NotEqual(t, firstKey.D, secondKey.D, "Each profile should have its own signing identity")
+}
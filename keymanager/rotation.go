@@ -0,0 +1,270 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/apex/log"
+)
+
+// DefaultGracePeriod is how long the previous signing identity is kept after a rotation by default
+const DefaultGracePeriod = 7 * 24 * time.Hour
+
+const (
+	// stagedPrefix is prepended to the file names of a signing identity that waits for its Key ID
+	stagedPrefix = "staged-"
+	// previousPrefix is prepended to the file names of the signing identity that was replaced by the last rotation
+	previousPrefix = "previous-"
+	// previousExpiryFileName is the file that holds the end of the previous signing identity's grace period
+	previousExpiryFileName = "previous-expires"
+)
+
+// StageSigningIdentity creates a new signing identity next to the active one, encrypted if a passphrase is given, and returns its public key.
+//
+// The staged identity isn't used for signing until CompleteRotation is called with the Key ID the CloudKit Dashboard assigned to the public key.
+func (c *CloudKitKeyManager) StageSigningIdentity(passphrase []byte) (*ecdsa.PublicKey, error) {
+	if c.environment != nil {
+		return nil, ErrReadOnly
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(c.pemFilePath()); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: create a signing identity instead of rotating it", ErrNoIdentity)
+	}
+
+	staged := c.rotationManager(stagedPrefix)
+	if _, err := os.Stat(staged.pemFilePath()); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrIdentityExists, staged.pemFilePath())
+	}
+
+	privateKey, err := generatePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := staged.writePrivateKey(privateKey, passphrase); err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// StagedPublicKey returns the public key of the signing identity staged by StageSigningIdentity
+func (c *CloudKitKeyManager) StagedPublicKey() (*ecdsa.PublicKey, error) {
+	staged := c.rotationManager(stagedPrefix)
+	return staged.PublicKey()
+}
+
+// CompleteRotation makes the staged signing identity the active one and stores its Key ID.
+//
+// The replaced identity is kept as the previous identity until the grace period has ended, see PreviousIdentity.
+// A previous identity whose grace period has already ended is deleted first.
+// The private key and the Key ID are each replaced with an atomic rename, so there is no moment without a signing identity.
+// Both renames happen under the lock, readers take the shared lock and see either the old or the new pair, never a mix of both.
+func (c *CloudKitKeyManager) CompleteRotation(keyID string, gracePeriod time.Duration) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+	if len(keyID) == 0 {
+		return fmt.Errorf("%w: the Key ID of the staged signing identity is required", ErrNoKeyID)
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	staged := c.rotationManager(stagedPrefix)
+	if _, err := staged.readPrivateKey(); err != nil {
+		return fmt.Errorf("the staged signing identity can't be used: %w", err)
+	}
+	if err := c.removeExpiredPreviousIdentity(); err != nil {
+		return err
+	}
+
+	previous := c.rotationManager(previousPrefix)
+	if err := copyFile(c.pemFilePath(), previous.pemFilePath()); err != nil {
+		return err
+	}
+	if err := copyOptionalFile(c.keyIDFilePath(), previous.keyIDFilePath()); err != nil {
+		return err
+	}
+	if err := copyOptionalFile(c.metadataFilePath(), previous.metadataFilePath()); err != nil {
+		return err
+	}
+	expires := time.Now().Add(gracePeriod).UTC().Format(time.RFC3339)
+	if err := writeFileAtomic(c.previousExpiryFilePath(), []byte(expires), secretsFileMode); err != nil {
+		return err
+	}
+
+	if err := staged.writeKeyID(keyID); err != nil {
+		return err
+	}
+	if err := renameAtomic(staged.pemFilePath(), c.pemFilePath()); err != nil {
+		return err
+	}
+	if err := renameAtomic(staged.keyIDFilePath(), c.keyIDFilePath()); err != nil {
+		return err
+	}
+	if err := renameAtomic(staged.metadataFilePath(), c.metadataFilePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	c.state().reset()
+	return nil
+}
+
+// PreviousIdentity returns a CloudKitKeyManager for the signing identity that was replaced by the last rotation.
+//
+// Once the grace period has ended, the previous identity is deleted and ErrNoIdentity is returned.
+func (c *CloudKitKeyManager) PreviousIdentity() (*CloudKitKeyManager, error) {
+	expires, err := c.PreviousIdentityExpires()
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(expires) {
+		c.pruneExpiredPreviousIdentity()
+		return nil, fmt.Errorf("%w: the grace period of the previous signing identity ended %s", ErrNoIdentity, expires.Format(time.RFC3339))
+	}
+	return c.rotationManager(previousPrefix), nil
+}
+
+// PreviousIdentityExpires returns the end of the previous signing identity's grace period
+func (c *CloudKitKeyManager) PreviousIdentityExpires() (time.Time, error) {
+	bytes, err := ioutil.ReadFile(c.previousExpiryFilePath())
+	if os.IsNotExist(err) {
+		return time.Time{}, fmt.Errorf("%w: no previous signing identity", ErrNoIdentity)
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, string(bytes))
+}
+
+// FallbackIdentity returns the previous signing identity while its grace period hasn't ended.
+//
+// Requests that CloudKit rejects are retried with it, e.g. while the Key ID passed to CompleteRotation is registered in the CloudKit Dashboard but not active yet.
+// A signing identity read from the environment has no previous identity.
+func (c *CloudKitKeyManager) FallbackIdentity() (KeyManagerV2, error) {
+	if c.environment != nil || c.isRotationManager() {
+		return nil, fmt.Errorf("%w: no previous signing identity", ErrNoIdentity)
+	}
+
+	previous, err := c.PreviousIdentity()
+	if err != nil {
+		return nil, err
+	}
+	log.Warnf("Falling back to the previous signing identity of the %s profile", c.Profile())
+	return previous, nil
+}
+
+// fallback returns the previous signing identity while the active one is missing and the grace period hasn't ended.
+//
+// An active identity that can't be decrypted or parsed is reported as an error and never replaced by the previous one.
+// One whose key CloudKit rejects is replaced per request through FallbackIdentity.
+func (c *CloudKitKeyManager) fallback() (*CloudKitKeyManager, bool) {
+	if c.isRotationManager() {
+		return nil, false
+	}
+	if _, err := os.Stat(c.pemFilePath()); !os.IsNotExist(err) {
+		return nil, false
+	}
+
+	previous, err := c.PreviousIdentity()
+	if err != nil {
+		return nil, false
+	}
+	log.Warnf("Falling back to the previous signing identity of the %s profile", c.Profile())
+	return previous, true
+}
+
+// pruneExpiredPreviousIdentity takes the lock and deletes the previous signing identity if its grace period has ended.
+// Failures are only logged, the previous identity is deleted again on the next attempt.
+func (c *CloudKitKeyManager) pruneExpiredPreviousIdentity() {
+	if c.isRotationManager() {
+		return
+	}
+	expires, err := c.PreviousIdentityExpires()
+	if err != nil || time.Now().Before(expires) {
+		return
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		log.Warnf("Failed to delete the expired previous signing identity (%s)", err)
+		return
+	}
+	defer unlock()
+	if err := c.removeExpiredPreviousIdentity(); err != nil {
+		log.Warnf("Failed to delete the expired previous signing identity (%s)", err)
+	}
+}
+
+// removeExpiredPreviousIdentity deletes the previous signing identity if its grace period has ended. The caller needs to hold the lock.
+func (c *CloudKitKeyManager) removeExpiredPreviousIdentity() error {
+	expires, err := c.PreviousIdentityExpires()
+	if errors.Is(err, ErrNoIdentity) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if time.Now().Before(expires) {
+		return nil
+	}
+
+	previous := c.rotationManager(previousPrefix)
+	for _, path := range []string{previous.pemFilePath(), previous.keyIDFilePath(), previous.metadataFilePath(), c.previousExpiryFilePath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	syncFolder(c.SecretsFolder())
+	return nil
+}
+
+// isRotationManager tells whether the key manager is one of the staged or previous identities, which have no fallback or previous identity of their own
+func (c *CloudKitKeyManager) isRotationManager() bool {
+	return strings.HasPrefix(c.pemFileName, stagedPrefix) || strings.HasPrefix(c.pemFileName, previousPrefix)
+}
+
+// rotationManager returns a CloudKitKeyManager for the staged or previous files next to the active signing identity
+func (c *CloudKitKeyManager) rotationManager(prefix string) *CloudKitKeyManager {
+	manager := NewWithSecretsFolder(c.secretsFolder, prefix+c.keyIDFileName, prefix+c.pemFileName)
+	manager.profile = c.profile
+	manager.passphrase = c.passphrase
+	return &manager
+}
+
+func (c *CloudKitKeyManager) previousExpiryFilePath() string {
+	return c.SecretsFolder() + "/" + previousExpiryFileName
+}
+
+// copyFile copies the file at source to destination, which is only readable by the owner
+func copyFile(source string, destination string) error {
+	bytes, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(destination, bytes, secretsFileMode)
+}
+
+// copyOptionalFile copies the file at source to destination, or removes destination if there is no source, so that it doesn't keep stale content
+func copyOptionalFile(source string, destination string) error {
+	err := copyFile(source, destination)
+	if os.IsNotExist(err) {
+		err = os.Remove(destination)
+		if os.IsNotExist(err) {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package keymanager
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rotationKeyManager(t *testing.T) CloudKitKeyManager {
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.Nil(t, manager.CreateSigningIdentity())
+	assert.Nil(t, manager.StoreKeyID("old key id"))
+	return manager
+}
+
+func TestRotation(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	oldKey, _ := manager.PrivateKey()
+
+	staged, err := manager.StageSigningIdentity(nil)
+	assert.Nil(t, err)
+	stagedPublicKey, _ := manager.StagedPublicKey()
+	assert.Equal(t, staged, stagedPublicKey)
+
+	activeKey, _ := manager.PrivateKey()
+	assert.Equal(t, oldKey.D, activeKey.D, "The staged identity must not be used before the rotation is complete")
+
+	assert.Nil(t, manager.CompleteRotation("new key id", time.Hour))
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	publicKey, _ := reader.PublicKey()
+	assert.Equal(t, staged, publicKey)
+	keyID, _ := reader.KeyID()
+	assert.Equal(t, "new key id", keyID)
+
+	previous, err := reader.PreviousIdentity()
+	assert.Nil(t, err)
+	previousKey, _ := previous.PrivateKey()
+	assert.Equal(t, oldKey.D, previousKey.D)
+	previousKeyID, _ := previous.KeyID()
+	assert.Equal(t, "old key id", previousKeyID)
+}
+
+func TestStageSigningIdentityOnlyOnce(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+
+	_, _ = manager.StageSigningIdentity(nil)
+	_, err := manager.StageSigningIdentity(nil)
+	assert.True(t, errors.Is(err, ErrIdentityExists))
+}
+
+func TestCompleteRotationRequiresStagedIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+
+	err := manager.CompleteRotation("new key id", time.Hour)
+	assert.True(t, errors.Is(err, ErrNoIdentity))
+}
+
+func TestFallbackToPreviousIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	oldKey, _ := manager.PrivateKey()
+	_, _ = manager.StageSigningIdentity(nil)
+	_ = manager.CompleteRotation("new key id", time.Hour)
+	_ = os.Remove("./testFiles/eckey.pem")
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	privateKey, err := reader.PrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, oldKey.D, privateKey.D, "The previous identity should be used while the active one is missing")
+	keyID, _ := reader.KeyID()
+	assert.Equal(t, "old key id", keyID)
+}
+
+func TestPreviousIdentityExpires(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	_, _ = manager.StageSigningIdentity(nil)
+	_ = manager.CompleteRotation("new key id", -time.Second)
+
+	_, err := manager.PreviousIdentity()
+	assert.True(t, errors.Is(err, ErrNoIdentity), "The previous identity should be gone after the grace period")
+	_, err = os.Stat("./testFiles/previous-eckey.pem")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExpiredPreviousIdentityIsDeletedOnLoad(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	_, _ = manager.StageSigningIdentity(nil)
+	_ = manager.CompleteRotation("new key id", -time.Second)
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := reader.PrivateKey()
+	assert.Nil(t, err)
+	for _, name := range []string{"previous-eckey.pem", "previous-keyid.txt", "previous-expires"} {
+		_, err = os.Stat("./testFiles/" + name)
+		assert.True(t, os.IsNotExist(err), "%s should be deleted once the grace period has ended", name)
+	}
+}
+
+func TestNoFallbackForUnreadableIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := rotationKeyManager(t)
+	_, _ = manager.StageSigningIdentity(nil)
+	_ = manager.CompleteRotation("new key id", time.Hour)
+	_ = ioutil.WriteFile("./testFiles/eckey.pem", []byte("corrupt"), 0600)
+
+	reader := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := reader.PrivateKey()
+	assert.True(t, errors.Is(err, ErrInvalidIdentity), "Only a missing signing identity falls back to the previous one")
+}
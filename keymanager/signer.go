@@ -0,0 +1,38 @@
+package keymanager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+)
+
+// CheckSigner verifies that the given signer holds a P-256 ECDSA key, the only kind of key CloudKit accepts
+func CheckSigner(signer crypto.Signer) error {
+	_, err := publicKeyOf(signer)
+	return err
+}
+
+// publicKeyOf returns the P-256 public key of the given signer
+func publicKeyOf(signer crypto.Signer) (*ecdsa.PublicKey, error) {
+	if signer == nil {
+		return nil, ErrNoIdentity
+	}
+
+	publicKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: the signer holds a %T", ErrUnsupportedKey, signer.Public())
+	}
+	if publicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: the signer's key uses %s", ErrUnsupportedKey, publicKey.Curve.Params().Name)
+	}
+	return publicKey, nil
+}
+
+// signerOf turns the result of a private key lookup into the result of a signer lookup
+func signerOf(privateKey *ecdsa.PrivateKey, err error) (crypto.Signer, error) {
+	if err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,31 @@
+package keymanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSignerAcceptsP256(t *testing.T) {
+	key, _ := generatePrivateKey()
+	assert.Nil(t, CheckSigner(key))
+}
+
+func TestCheckSignerRejectsOtherCurves(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.True(t, errors.Is(CheckSigner(key), ErrUnsupportedKey), "CloudKit only accepts P-256 keys")
+}
+
+func TestCheckSignerRejectsOtherKeyTypes(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	assert.True(t, errors.Is(CheckSigner(key), ErrUnsupportedKey), "CloudKit only accepts ECDSA keys")
+}
+
+func TestCheckSignerRejectsNil(t *testing.T) {
+	assert.True(t, errors.Is(CheckSigner(nil), ErrNoIdentity))
+}
@@ -0,0 +1,238 @@
+package keymanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// trashFolderName is the folder in a profile's secrets folder that removed signing identities are moved to
+	trashFolderName = "trash"
+	// trashTimeFormat names the folder of a removed signing identity in the trash
+	trashTimeFormat = "20060102T150405.000000000Z"
+)
+
+// A RemovedIdentity is a signing identity in the trash of a profile
+type RemovedIdentity struct {
+	// Name identifies the removed identity in the trash
+	Name string
+	// Removed is the time the identity was removed
+	Removed time.Time
+	// Fingerprint is the fingerprint of the removed identity's public key, if its metadata was kept
+	Fingerprint string
+}
+
+// RemoveSigningIdentity moves the signing identity, its Key ID and metadata into the trash of the secrets folder,
+// together with the previous identity of a rotation.
+//
+// Removed identities can be brought back with RestoreRemovedIdentity and are only deleted by PurgeRemovedIdentity.
+func (c *CloudKitKeyManager) RemoveSigningIdentity() error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer c.state().reset()
+
+	files := c.identityFileNames()
+	if !anyFileExists(c.SecretsFolder(), files) {
+		return fmt.Errorf("%w: nothing to remove in %s", ErrNoIdentity, c.SecretsFolder())
+	}
+
+	trash := filepath.Join(c.trashFolder(), time.Now().UTC().Format(trashTimeFormat))
+	if err := os.MkdirAll(trash, secretsFolderMode); err != nil {
+		return err
+	}
+	return moveFiles(c.SecretsFolder(), trash, files)
+}
+
+// RemovedIdentities lists the signing identities in the trash, the most recently removed first
+func (c *CloudKitKeyManager) RemovedIdentities() ([]RemovedIdentity, error) {
+	entries, err := ioutil.ReadDir(c.trashFolder())
+	if os.IsNotExist(err) {
+		return []RemovedIdentity{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	removed := []RemovedIdentity{}
+	for _, entry := range entries {
+		removedAt, err := time.Parse(trashTimeFormat, entry.Name())
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+
+		identity := RemovedIdentity{Name: entry.Name(), Removed: removedAt}
+		trashed := NewWithSecretsFolder(filepath.Join(c.trashFolder(), entry.Name()), c.keyIDFileName, c.pemFileName)
+		if metadata, err := trashed.storedMetadata(); err == nil {
+			identity.Fingerprint = metadata.Fingerprint
+		}
+		removed = append(removed, identity)
+	}
+
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Removed.After(removed[j].Removed)
+	})
+	return removed, nil
+}
+
+// RestoreRemovedIdentity moves the named signing identity from the trash back into place, or the most recently removed one if name is empty.
+// An existing signing identity is never overwritten.
+func (c *CloudKitKeyManager) RestoreRemovedIdentity(name string) error {
+	if c.environment != nil {
+		return ErrReadOnly
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	trash, err := c.removedIdentityFolder(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(c.pemFilePath()); err == nil {
+		return fmt.Errorf("%w: %s", ErrIdentityExists, c.pemFilePath())
+	}
+
+	if err := moveFiles(trash, c.SecretsFolder(), c.identityFileNames()); err != nil {
+		return err
+	}
+	c.state().reset()
+	return os.Remove(trash)
+}
+
+// PurgeRemovedIdentity finally deletes the named signing identity from the trash, or every removed identity if name is empty.
+//
+// The files are overwritten before they are deleted. Journaling and copy-on-write file systems or SSDs may still keep copies of the old content.
+func (c *CloudKitKeyManager) PurgeRemovedIdentity(name string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	folders := []string{}
+	if len(name) > 0 {
+		trash, err := c.removedIdentityFolder(name)
+		if err != nil {
+			return err
+		}
+		folders = append(folders, trash)
+	} else {
+		removed, err := c.RemovedIdentities()
+		if err != nil {
+			return err
+		}
+		for _, identity := range removed {
+			folders = append(folders, filepath.Join(c.trashFolder(), identity.Name))
+		}
+	}
+
+	for _, folder := range folders {
+		if err := purgeFolder(folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removedIdentityFolder returns the trash folder of the named removed identity, or of the most recently removed one if name is empty
+func (c *CloudKitKeyManager) removedIdentityFolder(name string) (string, error) {
+	if len(name) == 0 {
+		removed, err := c.RemovedIdentities()
+		if err != nil {
+			return "", err
+		}
+		if len(removed) == 0 {
+			return "", fmt.Errorf("%w: the trash is empty", ErrNoIdentity)
+		}
+		name = removed[0].Name
+	}
+
+	if _, err := time.Parse(trashTimeFormat, name); err != nil {
+		return "", fmt.Errorf("%w: `%s` is not a removed identity", ErrNoIdentity, name)
+	}
+	folder := filepath.Join(c.trashFolder(), name)
+	if _, err := os.Stat(folder); os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: `%s` is not in the trash", ErrNoIdentity, name)
+	}
+	return folder, nil
+}
+
+// identityFileNames returns the names of the files that make up the signing identity, including the previous identity of a rotation.
+// The previous identity goes wherever the active one goes, otherwise it would take over as the fallback of a removed identity.
+func (c *CloudKitKeyManager) identityFileNames() []string {
+	names := []string{c.pemFileName, c.keyIDFileName, c.pemFileName + metadataFileSuffix}
+	if c.isRotationManager() {
+		return names
+	}
+
+	previous := c.rotationManager(previousPrefix)
+	return append(names, append(previous.identityFileNames(), previousExpiryFileName)...)
+}
+
+func (c *CloudKitKeyManager) trashFolder() string {
+	return filepath.Join(c.SecretsFolder(), trashFolderName)
+}
+
+func anyFileExists(folder string, names []string) bool {
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(folder, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// moveFiles renames the named files from one folder into another, skipping the ones that don't exist
+func moveFiles(from string, to string, names []string) error {
+	for _, name := range names {
+		err := renameAtomic(filepath.Join(from, name), filepath.Join(to, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeFolder overwrites every file in the folder with zeros before it deletes the folder
+func purgeFolder(folder string) error {
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := overwriteFile(filepath.Join(folder, entry.Name()), entry.Size()); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(folder)
+}
+
+func overwriteFile(path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(make([]byte, size)); err != nil {
+		return err
+	}
+	return file.Sync()
+}
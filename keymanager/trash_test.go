@@ -0,0 +1,105 @@
+package keymanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveMovesIdentityIntoTrash(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.StoreKeyID("key id")
+	metadata, _ := manager.Metadata()
+
+	assert.Nil(t, manager.RemoveSigningIdentity())
+	_, err := os.Stat("./testFiles/eckey.pem")
+	assert.True(t, os.IsNotExist(err))
+
+	removed, err := manager.RemovedIdentities()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(removed))
+	assert.Equal(t, metadata.Fingerprint, removed[0].Fingerprint)
+}
+
+func TestRemoveWithoutIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.True(t, errors.Is(manager.RemoveSigningIdentity(), ErrNoIdentity))
+}
+
+func TestRemoveAfterRotationLeavesNoFallback(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.StoreKeyID("old key id")
+	_, _ = manager.StageSigningIdentity(nil)
+	assert.Nil(t, manager.CompleteRotation("new", time.Hour))
+
+	assert.Nil(t, manager.RemoveSigningIdentity())
+
+	fresh := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, err := fresh.PrivateKey()
+	assert.True(t, errors.Is(err, ErrNoIdentity), "The previous identity must not take over a removed one")
+	_, err = fresh.KeyID()
+	assert.True(t, errors.Is(err, ErrNoKeyID))
+
+	assert.Nil(t, manager.RestoreRemovedIdentity(""))
+	previous, err := manager.PreviousIdentity()
+	assert.Nil(t, err, "The previous identity should be restored with the active one")
+	previousKeyID, _ := previous.KeyID()
+	assert.Equal(t, "old key id", previousKeyID)
+}
+
+func TestRestoreRemovedIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.StoreKeyID("key id")
+	expected, _ := manager.PrivateKey()
+	_ = manager.RemoveSigningIdentity()
+
+	assert.Nil(t, manager.RestoreRemovedIdentity(""))
+	privateKey, err := manager.PrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, expected.D, privateKey.D)
+	keyID, _ := manager.KeyID()
+	assert.Equal(t, "key id", keyID)
+
+	removed, _ := manager.RemovedIdentities()
+	assert.Empty(t, removed, "A restored identity should leave the trash")
+}
+
+func TestRestoreRemovedIdentityKeepsExistingIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.RemoveSigningIdentity()
+	_ = manager.CreateSigningIdentity()
+
+	assert.True(t, errors.Is(manager.RestoreRemovedIdentity(""), ErrIdentityExists))
+}
+
+func TestRestoreUnknownRemovedIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.True(t, errors.Is(manager.RestoreRemovedIdentity("../eckey.pem"), ErrNoIdentity))
+	assert.True(t, errors.Is(manager.RestoreRemovedIdentity(""), ErrNoIdentity))
+}
+
+func TestPurgeRemovedIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = manager.CreateSigningIdentity()
+	_ = manager.RemoveSigningIdentity()
+	_ = manager.CreateSigningIdentity()
+	_ = manager.RemoveSigningIdentity()
+
+	assert.Nil(t, manager.PurgeRemovedIdentity(""))
+	removed, _ := manager.RemovedIdentities()
+	assert.Empty(t, removed)
+}
@@ -0,0 +1,157 @@
+package keymanager
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher checks the signing identity for changes by default
+const DefaultWatchInterval = 10 * time.Second
+
+// A ReloadFunc is called by a Watcher after it reloaded the signing identity. The error is nil if the new identity is in use
+// and describes why it was rejected otherwise.
+type ReloadFunc func(err error)
+
+// A Watcher polls the private key and Key ID files of a CloudKitKeyManager and reloads them when they change
+type Watcher struct {
+	manager  *CloudKitKeyManager
+	interval time.Duration
+	onReload ReloadFunc
+	state    watchState
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// watchState is what a Watcher compares to detect changes
+type watchState struct {
+	pem   fileState
+	keyID fileState
+}
+
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// Watch starts a Watcher that checks the private key and Key ID files every interval.
+//
+// A changed pair is only swapped in if the private key can be read and used for signing and a Key ID is stored.
+// Otherwise the current pair stays in use and the reload is retried every interval until it succeeds. Requests that are being signed keep the pair they started with.
+func (c *CloudKitKeyManager) Watch(interval time.Duration, onReload ReloadFunc) (*Watcher, error) {
+	if c.environment != nil {
+		return nil, ErrReadOnly
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid watch interval %s", interval)
+	}
+
+	watcher := &Watcher{
+		manager:  c,
+		interval: interval,
+		onReload: onReload,
+		state:    c.watchState(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go watcher.run()
+	return watcher, nil
+}
+
+// Stop stops the Watcher and waits for a running reload to finish
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.stopped
+}
+
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll reloads the signing identity if its files changed. A failed reload is retried on the next poll, even if the files don't change again,
+// so that a change isn't lost to a transient failure, e.g. a permission that is fixed after the file was written.
+func (w *Watcher) poll() {
+	state := w.manager.watchState()
+	if state == w.state {
+		return
+	}
+
+	err := w.manager.reloadValidated()
+	if err == nil {
+		w.state = state
+	}
+	if w.onReload != nil {
+		w.onReload(err)
+	}
+}
+
+func (c *CloudKitKeyManager) watchState() watchState {
+	return watchState{pem: statFile(c.pemFilePath()), keyID: statFile(c.keyIDFilePath())}
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+// reloadValidated reads the private key and the Key ID from the secrets folder and swaps them in if both can be used.
+// Both are read under the folder's shared lock, so that a pair that is being written, e.g. by a rotation, is never read halfway.
+func (c *CloudKitKeyManager) reloadValidated() error {
+	fresh := NewWithSecretsFolder(c.secretsFolder, c.keyIDFileName, c.pemFileName)
+	fresh.profile = c.profile
+	fresh.passphrase = c.passphrase
+
+	privateKey, err := fresh.PrivateKey()
+	if err != nil {
+		return err
+	}
+	if err := CheckSigner(privateKey); err != nil {
+		return err
+	}
+	keyID, err := fresh.storedKeyID()
+	if err != nil {
+		return err
+	}
+
+	c.state().swap(privateKey, keyID)
+	return nil
+}
+
+// Identity returns the signer and the Key ID as a pair that was in use at the same time, even while a Watcher swaps them
+func (c *CloudKitKeyManager) Identity() (crypto.Signer, string, error) {
+	for {
+		generation := c.Generation()
+		keyID, err := c.KeyID()
+		if err != nil {
+			return nil, "", err
+		}
+		signer, err := c.Signer()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if c.Generation() == generation {
+			return signer, keyID, nil
+		}
+	}
+}
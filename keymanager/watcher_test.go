@@ -0,0 +1,95 @@
+package keymanager
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func watchedKeyManager(t *testing.T) (CloudKitKeyManager, chan error) {
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.Nil(t, writer.CreateSigningIdentity())
+	assert.Nil(t, writer.StoreKeyID("first"))
+
+	manager := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_, _ = manager.PrivateKey()
+	_, _ = manager.KeyID()
+	return manager, make(chan error, 10)
+}
+
+func awaitReload(t *testing.T, reloads chan error) error {
+	select {
+	case err := <-reloads:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("The watcher should have reloaded the signing identity")
+		return nil
+	}
+}
+
+func TestWatcherReloadsChangedIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager, reloads := watchedKeyManager(t)
+	watcher, err := manager.Watch(10*time.Millisecond, func(err error) { reloads <- err })
+	assert.Nil(t, err)
+	defer watcher.Stop()
+
+	writer := NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = writer.CreateSigningIdentity()
+	_ = writer.StoreKeyID("second")
+	expected, _ := writer.PrivateKey()
+
+	_, keyID, _ := manager.Identity()
+	for keyID != "second" {
+		assert.Nil(t, awaitReload(t, reloads))
+		_, keyID, _ = manager.Identity()
+	}
+	privateKey, _ := manager.PrivateKey()
+	assert.Equal(t, expected.D, privateKey.D)
+}
+
+func TestWatcherKeepsIdentityWhenReloadFails(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager, reloads := watchedKeyManager(t)
+	expected, _ := manager.PrivateKey()
+	watcher, _ := manager.Watch(10*time.Millisecond, func(err error) { reloads <- err })
+	defer watcher.Stop()
+
+	_ = ioutil.WriteFile("./testFiles/eckey.pem", []byte("not a key"), 0600)
+
+	assert.NotNil(t, awaitReload(t, reloads), "A broken private key should be reported")
+	privateKey, err := manager.PrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, expected.D, privateKey.D, "A broken private key should not replace the one in use")
+}
+
+func TestWatcherStop(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager, _ := watchedKeyManager(t)
+	watcher, _ := manager.Watch(time.Hour, nil)
+
+	watcher.Stop()
+	watcher.Stop()
+}
+
+func TestWatcherRetriesFailedReload(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager, reloads := watchedKeyManager(t)
+	watcher, _ := manager.Watch(10*time.Millisecond, func(err error) { reloads <- err })
+	defer watcher.Stop()
+
+	_ = writeFileAtomic("./testFiles/keyid.txt", []byte("second"), 0640)
+	assert.NotNil(t, awaitReload(t, reloads), "A Key ID other users can read should be refused")
+
+	// fixing the mode doesn't change the file's size or modification time
+	_ = os.Chmod("./testFiles/keyid.txt", 0600)
+	err := awaitReload(t, reloads)
+	for err != nil {
+		err = awaitReload(t, reloads)
+	}
+	_, keyID, _ := manager.Identity()
+	assert.Equal(t, "second", keyID)
+}
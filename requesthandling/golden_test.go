@@ -0,0 +1,98 @@
+package requesthandling
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/q231950/sputnik/keymanager/keymanagertest"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files in fixtures/golden")
+
+// goldenRequest renders the method, the URL and the headers of a request in a stable order
+func goldenRequest(request *http.Request) []byte {
+	lines := []string{fmt.Sprintf("%s %s", request.Method, request.URL)}
+	names := []string{}
+	for name := range request.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %s", name, strings.Join(request.Header[name], ", ")))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func assertGolden(t *testing.T, name string, request *http.Request) {
+	golden := filepath.Join("fixtures", "golden", name+".txt")
+	actual := goldenRequest(request)
+	if *update {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(golden), 0755))
+		assert.Nil(t, ioutil.WriteFile(golden, actual, 0644))
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(actual), "The request should match %s, run the tests with -update after intended changes", golden)
+}
+
+func TestGoldenRequests(t *testing.T) {
+	config := NewRequestConfig("1", "iCloud.com.elbedev.shelve.dev", "public")
+	requestManager := New(config, keymanagertest.KeyManager(), WithClock(keymanagertest.Clock(keymanagertest.Time)))
+
+	post, err := requestManager.PostRequest("modify", `{"operations":[]}`)
+	assert.Nil(t, err)
+	assertGolden(t, "post_modify", post)
+
+	get, err := requestManager.GetRequest("query", "")
+	assert.Nil(t, err)
+	assertGolden(t, "get_query", get)
+}
+
+func TestWithClock(t *testing.T) {
+	config := NewRequestConfig("1", "containerID", "public")
+	requestManager := New(config, keymanagertest.KeyManager(), WithClock(keymanagertest.Clock(keymanagertest.Time)))
+	request, err := requestManager.PostRequest("modify", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "2016-11-07T20:15:00Z", request.Header.Get("X-Apple-CloudKit-Request-ISO8601Date"))
+}
+
+func TestBaseURL(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer server.Close()
+
+	config := NewRequestConfig("1", "iCloud.com.elbedev.shelve.dev", "public")
+	clock := WithClock(keymanagertest.Clock(keymanagertest.Time))
+	expected, err := New(config, keymanagertest.KeyManager(), clock).PostRequest("modify", `{"operations":[]}`)
+	assert.Nil(t, err)
+
+	config.BaseURL = server.URL + "/cloudkit/"
+	request, err := New(config, keymanagertest.KeyManager(), clock).PostRequest("modify", `{"operations":[]}`)
+	assert.Nil(t, err)
+	_, err = http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "/cloudkit/database/1/iCloud.com.elbedev.shelve.dev/development/public/records/modify", received.URL.Path)
+	assert.Equal(t, expected.Header.Get("X-Apple-CloudKit-Request-SignatureV1"), received.Header.Get("X-Apple-CloudKit-Request-SignatureV1"), "The signature should only cover the subpath")
+}
+
+func TestInvalidBaseURL(t *testing.T) {
+	config := NewRequestConfig("1", "containerID", "public")
+	config.BaseURL = "ftp://example.com"
+	request, err := New(config, keymanagertest.KeyManager()).PostRequest("modify", "")
+	assert.Nil(t, request)
+	assert.True(t, errors.Is(err, ErrInvalidBaseURL))
+}
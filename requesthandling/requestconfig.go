@@ -1,13 +1,117 @@
 package requesthandling
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/q231950/sputnik/keymanager"
+)
+
+// DefaultBaseURL is CloudKit's Web Services endpoint, requests go there unless a RequestConfig says otherwise
+const DefaultBaseURL = "https://api.apple-cloudkit.com"
+
+const (
+	// DevelopmentEnvironment is CloudKit's development environment, requests go there unless a RequestConfig says otherwise
+	DevelopmentEnvironment = keymanager.DevelopmentEnvironment
+	// ProductionEnvironment is CloudKit's production environment
+	ProductionEnvironment = keymanager.ProductionEnvironment
+)
+
+var (
+	// ErrInvalidEnvironment is returned for requests to environments other than development and production
+	ErrInvalidEnvironment = errors.New("the CloudKit environment must be development or production")
+
+	// ErrInvalidBaseURL is returned for base URLs that aren't absolute http or https URLs with a host
+	ErrInvalidBaseURL = errors.New("the base URL must be an http or https URL with a host")
+
+	// ErrProductionWrite is returned for write operations on production data when the RequestConfig doesn't allow them
+	ErrProductionWrite = errors.New("writing to the production environment is not allowed")
+)
+
+// writeOperations are the operations that change records
+var writeOperations = map[string]bool{"modify": true, "accept": true}
+
 // RequestConfig is used to initialise RequestManagers. It specifies the Cloudkit API version and container ID to use for requests
 type RequestConfig struct {
 	Version     string
 	ContainerID string
 	Database    string
+	// Environment is the CloudKit environment, DevelopmentEnvironment or ProductionEnvironment. It defaults to DevelopmentEnvironment.
+	Environment string
+	// AllowProductionWrites opts in to write operations, e.g. modify, in the production environment
+	AllowProductionWrites bool
+	// BaseURL is the scheme, host and optional path prefix requests are sent to, e.g. a recording proxy or a local fake server.
+	// It defaults to DefaultBaseURL. Signatures only cover the path after the base URL, as CloudKit requires.
+	BaseURL string
 }
 
-// NewRequestConfig creates a fresh config with the given version and container ID
+// NewRequestConfig creates a fresh config with the given version and container ID for the development environment
 func NewRequestConfig(version string, containerID string, database string) RequestConfig {
 	return RequestConfig{Version: version, ContainerID: containerID, Database: database}
 }
+
+// NewRequestConfigForEnvironment creates a fresh config with the given version and container ID for the given environment
+func NewRequestConfigForEnvironment(version string, containerID string, database string, environment string) RequestConfig {
+	return RequestConfig{Version: version, ContainerID: containerID, Database: database, Environment: environment}
+}
+
+// ValidateEnvironment checks that the environment is DevelopmentEnvironment or ProductionEnvironment. An empty environment stands for DevelopmentEnvironment.
+func ValidateEnvironment(environment string) error {
+	switch environment {
+	case "", DevelopmentEnvironment, ProductionEnvironment:
+		return nil
+	default:
+		return fmt.Errorf("%w: `%s`", ErrInvalidEnvironment, environment)
+	}
+}
+
+// Validate checks that the config names a CloudKit environment and, if any, a usable base URL
+func (c RequestConfig) Validate() error {
+	if err := ValidateEnvironment(c.Environment); err != nil {
+		return err
+	}
+
+	if len(c.BaseURL) == 0 {
+		return nil
+	}
+	baseURL, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBaseURL, err)
+	}
+	if baseURL.Scheme != "https" && baseURL.Scheme != "http" {
+		return fmt.Errorf("%w: `%s` has the scheme `%s`", ErrInvalidBaseURL, c.BaseURL, baseURL.Scheme)
+	}
+	if len(baseURL.Hostname()) == 0 {
+		return fmt.Errorf("%w: `%s` has no host", ErrInvalidBaseURL, c.BaseURL)
+	}
+	if baseURL.User != nil || len(baseURL.RawQuery) > 0 || len(baseURL.Fragment) > 0 {
+		return fmt.Errorf("%w: `%s` may not have credentials, a query or a fragment", ErrInvalidBaseURL, c.BaseURL)
+	}
+	return nil
+}
+
+// baseURL returns the configured base URL without trailing slash or, without one, DefaultBaseURL
+func (c RequestConfig) baseURL() string {
+	if len(c.BaseURL) == 0 {
+		return DefaultBaseURL
+	}
+	return strings.TrimRight(c.BaseURL, "/")
+}
+
+// environment returns the configured environment or, without one, DevelopmentEnvironment
+func (c RequestConfig) environment() string {
+	if len(c.Environment) == 0 {
+		return DevelopmentEnvironment
+	}
+	return c.Environment
+}
+
+// checkOperation refuses write operations in production unless they are allowed
+func (c RequestConfig) checkOperation(operation string) error {
+	if c.environment() == ProductionEnvironment && writeOperations[operation] && !c.AllowProductionWrites {
+		return fmt.Errorf("%w: `%s` changes production data, allow it explicitly", ErrProductionWrite, operation)
+	}
+	return nil
+}
@@ -8,14 +8,17 @@ package requesthandling
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	log "github.com/apex/log"
+	"github.com/q231950/sputnik/audit"
 	"github.com/q231950/sputnik/keymanager"
 )
 
@@ -40,12 +43,80 @@ type RequestManager interface {
 // CloudkitRequestManager is the concrete implementation of RequestManager
 type CloudkitRequestManager struct {
 	Config     RequestConfig
-	keyManager keymanager.KeyManager
+	keyManager keymanager.KeyManagerV2
+	clock      func() time.Time
+	auditLog   *audit.Log
+	// setupErr is the error from validating the config or resolving the key manager for the configured container, it is returned by every request
+	setupErr error
+}
+
+// An Option changes how a CloudkitRequestManager creates requests
+type Option func(*CloudkitRequestManager)
+
+// WithClock makes the CloudkitRequestManager date its requests with the given clock instead of time.Now.
+//
+// Together with a key manager from keymanagertest, requests become reproducible, e.g. for comparing them with golden files.
+func WithClock(clock func() time.Time) Option {
+	return func(cm *CloudkitRequestManager) {
+		cm.clock = clock
+	}
+}
+
+// WithAuditLog makes the CloudkitRequestManager append every signature it produces to the audit log.
+// Requests and signatures that can't be logged are not handed out.
+func WithAuditLog(auditLog *audit.Log) Option {
+	return func(cm *CloudkitRequestManager) {
+		cm.auditLog = auditLog
+	}
 }
 
 // New creates a new RequestManager
-func New(config RequestConfig, keyManager keymanager.KeyManager) CloudkitRequestManager {
-	return CloudkitRequestManager{Config: config, keyManager: keyManager}
+//
+// KeyManagers that implement the deprecated keymanager.KeyManager interface can be passed in through keymanager.Adapt.
+// A keymanager.Resolver is resolved for the container and environment of the config, so that requests are signed with the credentials bound to them.
+func New(config RequestConfig, keyManager keymanager.KeyManagerV2, options ...Option) CloudkitRequestManager {
+	cm := CloudkitRequestManager{Config: config, keyManager: keyManager, clock: time.Now}
+	for _, option := range options {
+		option(&cm)
+	}
+
+	if cm.setupErr = config.Validate(); cm.setupErr != nil {
+		return cm
+	}
+	if resolver, ok := keyManager.(interface {
+		KeyManagerFor(containerID string, environment string) (keymanager.KeyManagerV2, error)
+	}); ok {
+		cm.keyManager, cm.setupErr = resolver.KeyManagerFor(config.ContainerID, cm.environment())
+	}
+	return cm
+}
+
+// Fallback returns a CloudkitRequestManager that signs with the fallback identity of the key manager,
+// e.g. the previous signing identity of a keymanager.CloudKitKeyManager during the grace period of a rotation.
+//
+// Use it to create a request again when CloudKit rejected it, see IsRejected. Key managers without a fallback identity return keymanager.ErrNoIdentity.
+func (cm CloudkitRequestManager) Fallback() (CloudkitRequestManager, error) {
+	if cm.setupErr != nil {
+		return cm, cm.setupErr
+	}
+
+	fallback, ok := cm.keyManager.(interface {
+		FallbackIdentity() (keymanager.KeyManagerV2, error)
+	})
+	if !ok {
+		return cm, fmt.Errorf("%w: the key manager has no fallback identity", keymanager.ErrNoIdentity)
+	}
+	keyManager, err := fallback.FallbackIdentity()
+	if err != nil {
+		return cm, err
+	}
+	cm.keyManager = keyManager
+	return cm, nil
+}
+
+// IsRejected tells whether CloudKit refused the response's request because of its signature or Key ID, e.g. because the Key ID isn't active yet
+func IsRejected(response *http.Response) bool {
+	return response.StatusCode == http.StatusUnauthorized
 }
 
 // PostRequest is a convenience method for creating POST requests
@@ -60,15 +131,33 @@ func (cm CloudkitRequestManager) GetRequest(operationPath string, body string) (
 
 // Request creates a signed request with the given parameters
 func (cm *CloudkitRequestManager) request(p string, method HTTPMethod, payload string) (*http.Request, error) {
-	keyID := cm.keyManager.KeyID()
+	if cm.setupErr != nil {
+		return nil, cm.setupErr
+	}
+	if err := cm.Config.checkOperation(p); err != nil {
+		return nil, err
+	}
+
+	signer, keyID, err := cm.identity()
+	if err != nil {
+		return nil, err
+	}
 
-	currentDate := cm.formattedTime(time.Now())
+	now := cm.now()
+	currentDate := cm.formattedTime(now)
 	path := cm.subpath(p)
 	hashedBody := cm.HashedBody(payload)
 	message := cm.message(currentDate, hashedBody, path)
-	signature := cm.SignatureForMessage([]byte(message))
+	signature, err := cm.sign(signer, []byte(message))
+	if err != nil {
+		return nil, err
+	}
+	err = cm.audit(signer, audit.Entry{Time: now, KeyID: keyID, Method: string(method), Path: path, BodyHash: hashedBody})
+	if err != nil {
+		return nil, err
+	}
 	encodedSignature := string(base64.StdEncoding.EncodeToString(signature))
-	url := "https://api.apple-cloudkit.com" + path
+	url := cm.Config.baseURL() + path
 
 	log.WithFields(log.Fields{
 		"key id": keyID,
@@ -89,6 +178,9 @@ func (cm *CloudkitRequestManager) request(p string, method HTTPMethod, payload s
 //	- signature Header parameter X-Apple-CloudKit-Request-SignatureV1
 func (cm *CloudkitRequestManager) requestWithHeaders(method string, url string, body []byte, keyID string, date string, signature string) (request *http.Request, err error) {
 	request, err = http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
 	request.Header.Set("X-Apple-CloudKit-Request-KeyID", keyID)
 	request.Header.Set("X-Apple-CloudKit-Request-ISO8601Date", date)
 	request.Header.Set("X-Apple-CloudKit-Request-SignatureV1", signature)
@@ -97,35 +189,134 @@ func (cm *CloudkitRequestManager) requestWithHeaders(method string, url string,
 }
 
 // SignatureForMessage returns the signature for the given message
-func (cm *CloudkitRequestManager) SignatureForMessage(message []byte) (signature []byte) {
-	priv := cm.keyManager.PrivateKey()
+//
+// The message is signed through the key manager's crypto.Signer, which needs to hold a P-256 key.
+// With an audit log, the Key ID is required as well, it is logged together with the signer's fingerprint.
+func (cm *CloudkitRequestManager) SignatureForMessage(message []byte) (signature []byte, err error) {
+	if cm.setupErr != nil {
+		return nil, cm.setupErr
+	}
+	if cm.auditLog == nil {
+		signer, err := cm.signer()
+		if err != nil {
+			return nil, err
+		}
+		return cm.sign(signer, message)
+	}
+
+	// the audit log records the Key ID next to the fingerprint, so both need to come from the same identity
+	signer, keyID, err := cm.identity()
+	if err != nil {
+		return nil, err
+	}
+	signature, err = cm.sign(signer, message)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.audit(signer, audit.Entry{KeyID: keyID, MessageHash: cm.HashedBody(string(message))}); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// audit appends the signature described by the entry to the audit log, if there is one
+func (cm *CloudkitRequestManager) audit(signer crypto.Signer, entry audit.Entry) error {
+	if cm.auditLog == nil {
+		return nil
+	}
+
+	publicKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return keymanager.ErrUnsupportedKey
+	}
+	fingerprint, err := keymanager.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = cm.now()
+	}
+	entry.Fingerprint = fingerprint
+	if _, err := cm.auditLog.Append(entry); err != nil {
+		log.WithError(err).Error("Unable to write the audit log")
+		return err
+	}
+	return nil
+}
+
+// sign signs the SHA-256 hash of the message with the given signer
+func (cm *CloudkitRequestManager) sign(signer crypto.Signer, message []byte) (signature []byte, err error) {
 	rand := rand.Reader
 
 	h := sha256.New()
 	h.Write([]byte(message))
 
 	opts := crypto.SHA256
-	if priv != nil {
-		signature, err := priv.Sign(rand, h.Sum(nil), opts)
+	signature, err = signer.Sign(rand, h.Sum(nil), opts)
+	if err != nil {
+		log.WithError(err).Error("Unable to sign message")
+		return nil, err
+	}
+
+	return signature, nil
+}
+
+// identity returns the signer and the Key ID to sign a request with.
+//
+// Key managers whose identity can change while requests are created, like a watched keymanager.CloudKitKeyManager, hand out both as one pair.
+func (cm *CloudkitRequestManager) identity() (crypto.Signer, string, error) {
+	if paired, ok := cm.keyManager.(interface {
+		Identity() (crypto.Signer, string, error)
+	}); ok {
+		signer, keyID, err := paired.Identity()
 		if err != nil {
-			log.WithError(err).Error("Unable to sign message")
+			return nil, "", err
 		}
+		return signer, keyID, keymanager.CheckSigner(signer)
+	}
 
-		return signature
+	keyID, err := cm.keyManager.KeyID()
+	if err != nil {
+		return nil, "", err
 	}
+	signer, err := cm.signer()
+	return signer, keyID, err
+}
 
-	log.Fatal("Can't sign without a private key")
+// signer returns the key manager's crypto.Signer after making sure it holds a key CloudKit accepts
+func (cm *CloudkitRequestManager) signer() (crypto.Signer, error) {
+	if cm.setupErr != nil {
+		return nil, cm.setupErr
+	}
 
-	return nil
+	signer, err := cm.keyManager.Signer()
+	if err != nil {
+		return nil, err
+	}
+	return signer, keymanager.CheckSigner(signer)
 }
 
 func (cm *CloudkitRequestManager) subpath(path string) string {
 	version := cm.Config.Version
 	containerID := cm.Config.ContainerID
-	components := []string{"/database", version, containerID, "development", cm.Config.Database, "records", path}
+	components := []string{"/database", version, containerID, cm.environment(), cm.Config.Database, "records", path}
 	return strings.Join(components, "/")
 }
 
+// now returns the current time of the request manager's clock
+func (cm *CloudkitRequestManager) now() time.Time {
+	if cm.clock == nil {
+		return time.Now()
+	}
+	return cm.clock()
+}
+
+// environment returns the CloudKit environment requests are sent to
+func (cm *CloudkitRequestManager) environment() string {
+	return cm.Config.environment()
+}
+
 func (cm *CloudkitRequestManager) formattedTime(t time.Time) string {
 	date := t.UTC().Format(time.RFC3339)
 	return date
@@ -1,6 +1,7 @@
 package requesthandling
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"testing"
@@ -91,3 +92,30 @@ func TestRequestScheme(t *testing.T) {
 	request, _ := samplePostRequest()
 	assert.Equal(t, "https", request.URL.Scheme)
 }
+
+func TestProductionRequestPath(t *testing.T) {
+	config := NewRequestConfigForEnvironment("1", "iCloud.com.elbedev.shelve", "public", ProductionEnvironment)
+	requestManager := New(config, mocks.MockKeyManager{})
+	request, err := requestManager.PostRequest("query", "{}")
+	assert.Nil(t, err)
+	assert.Equal(t, "/database/1/iCloud.com.elbedev.shelve/production/public/records/query", request.URL.Path)
+}
+
+func TestProductionWritesNeedOptIn(t *testing.T) {
+	config := NewRequestConfigForEnvironment("1", "iCloud.com.elbedev.shelve", "public", ProductionEnvironment)
+	request, err := New(config, mocks.MockKeyManager{}).PostRequest("modify", "{}")
+	assert.Nil(t, request)
+	assert.True(t, errors.Is(err, ErrProductionWrite))
+
+	config.AllowProductionWrites = true
+	request, err = New(config, mocks.MockKeyManager{}).PostRequest("modify", "{}")
+	assert.Nil(t, err)
+	assert.NotNil(t, request)
+}
+
+func TestInvalidEnvironmentRequest(t *testing.T) {
+	config := NewRequestConfigForEnvironment("1", "iCloud.com.elbedev.shelve", "public", "staging")
+	request, err := New(config, mocks.MockKeyManager{}).PostRequest("query", "{}")
+	assert.Nil(t, request)
+	assert.True(t, errors.Is(err, ErrInvalidEnvironment))
+}
@@ -1,10 +1,24 @@
 package requesthandling
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/q231950/sputnik/audit"
+	sputnikkeymanager "github.com/q231950/sputnik/keymanager"
+	"github.com/q231950/sputnik/keymanager/keymanagertest"
 	keymanager "github.com/q231950/sputnik/keymanager/mocks"
+	"github.com/stretchr/testify/assert"
 )
 
 type TestableRequestManager interface {
@@ -43,7 +57,7 @@ func TestMessageFormat(t *testing.T) {
 func TestEmptyHashedBody(t *testing.T) {
 	keyManager := keymanager.MockKeyManager{}
 	config := NewRequestConfig("version", "containerID", "public")
-	requestManager := TestableRequestManager(&CloudkitRequestManager{config, &keyManager})
+	requestManager := TestableRequestManager(&CloudkitRequestManager{Config: config, keyManager: &keyManager})
 	body := ""
 	hash := requestManager.HashedBody(body)
 
@@ -56,9 +70,182 @@ func TestSignMessage(t *testing.T) {
 	keyManager := keymanager.MockKeyManager{}
 	config := NewRequestConfig("version", "containerID", "public")
 	r := New(config, &keyManager)
-	signature := r.SignatureForMessage([]byte("message"))
+	signature, err := r.SignatureForMessage([]byte("message"))
 
-	if signature == nil {
+	if signature == nil || err != nil {
 		t.Errorf("A message should be signed when a private key is available")
 	}
 }
+
+// identitylessKeyManager is a KeyManagerV2 without a signing identity
+type identitylessKeyManager struct {
+	keymanager.MockKeyManager
+}
+
+func (m identitylessKeyManager) Signer() (crypto.Signer, error) {
+	return nil, sputnikkeymanager.ErrNoIdentity
+}
+
+func TestSignMessageWithoutIdentity(t *testing.T) {
+	config := NewRequestConfig("version", "containerID", "public")
+	r := New(config, identitylessKeyManager{})
+	signature, err := r.SignatureForMessage([]byte("message"))
+
+	assert.Nil(t, signature)
+	assert.True(t, errors.Is(err, sputnikkeymanager.ErrNoIdentity), "A missing identity should be passed back instead of terminating")
+}
+
+func TestPostRequestWithoutIdentity(t *testing.T) {
+	config := NewRequestConfig("version", "containerID", "public")
+	r := New(config, identitylessKeyManager{})
+	request, err := r.PostRequest("modify", "{}")
+
+	assert.Nil(t, request)
+	assert.True(t, errors.Is(err, sputnikkeymanager.ErrNoIdentity), "A missing identity should be passed back from PostRequest")
+}
+
+// signerKeyManager is a KeyManagerV2 that signs with the given crypto.Signer, like HSM or KMS backed key managers do
+type signerKeyManager struct {
+	keymanager.MockKeyManager
+	signer crypto.Signer
+}
+
+func (m signerKeyManager) Signer() (crypto.Signer, error) {
+	return m.signer, nil
+}
+
+func TestSignMessageWithSigner(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	config := NewRequestConfig("version", "containerID", "public")
+	r := New(config, signerKeyManager{signer: key})
+	signature, err := r.SignatureForMessage([]byte("message"))
+	assert.Nil(t, err)
+
+	digest := sha256.Sum256([]byte("message"))
+	assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature), "The message should be signed by the key manager's signer")
+}
+
+func TestSignMessageRequiresP256(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	config := NewRequestConfig("version", "containerID", "public")
+	r := New(config, signerKeyManager{signer: key})
+	signature, err := r.SignatureForMessage([]byte("message"))
+
+	assert.Nil(t, signature)
+	assert.True(t, errors.Is(err, sputnikkeymanager.ErrUnsupportedKey), "CloudKit only accepts P-256 keys")
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	der, _ := ioutil.ReadFile("./fixtures/test_identity.der")
+	keyManager := sputnikkeymanager.NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	_ = keyManager.ImportSigningIdentity(der, nil)
+	_ = keyManager.StoreKeyID("key id")
+
+	reader := sputnikkeymanager.NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	config := NewRequestConfig("1", "containerID", "public")
+	requestManager := New(config, &reader)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, err := requestManager.PostRequest("records/query", "{}")
+			assert.Nil(t, err)
+			assert.Equal(t, "key id", request.Header.Get("X-Apple-CloudKit-Request-KeyID"))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewResolvesBoundCredentials(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	assert.Nil(t, sputnikkeymanager.Bind("./testFiles", sputnikkeymanager.Binding{ContainerID: "iCloud.bound", Environment: sputnikkeymanager.DevelopmentEnvironment, KeyID: "bound key id"}))
+	resolver, err := sputnikkeymanager.NewResolver("./testFiles", keymanager.MockKeyManager{})
+	assert.Nil(t, err)
+
+	request, err := New(NewRequestConfig("1", "iCloud.bound", "public"), resolver).PostRequest("modify", "{}")
+	assert.Nil(t, err)
+	assert.Equal(t, "bound key id", request.Header.Get("X-Apple-CloudKit-Request-KeyID"))
+
+	request, err = New(NewRequestConfig("1", "iCloud.other", "public"), resolver).PostRequest("modify", "{}")
+	assert.Nil(t, err)
+	assert.Equal(t, "key id", request.Header.Get("X-Apple-CloudKit-Request-KeyID"), "Unbound containers should use the resolver's key manager")
+}
+
+func TestAuditLog(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	auditLog := audit.Open("./testFiles/audit.jsonl")
+	config := NewRequestConfig("1", "containerID", "public")
+	r := New(config, keymanagertest.KeyManager(), WithAuditLog(auditLog), WithClock(keymanagertest.Clock(keymanagertest.Time)))
+
+	_, err := r.PostRequest("modify", `{"secret":"body"}`)
+	assert.Nil(t, err)
+	_, err = r.SignatureForMessage([]byte("message"))
+	assert.Nil(t, err)
+
+	head, err := audit.Verify(auditLog.Path())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), head.Entries)
+
+	data, _ := ioutil.ReadFile(auditLog.Path())
+	fingerprint, _ := sputnikkeymanager.Fingerprint(&keymanagertest.Key().PublicKey)
+	assert.True(t, strings.Contains(string(data), fingerprint))
+	assert.True(t, strings.Contains(string(data), `"path":"/database/1/containerID/development/public/records/modify"`))
+	assert.False(t, strings.Contains(string(data), "secret"), "The audit log must not contain request bodies")
+}
+
+// keyIDlessKeyManager is a KeyManagerV2 with a signing identity but without a Key ID
+type keyIDlessKeyManager struct {
+	keymanager.MockKeyManager
+}
+
+func (m keyIDlessKeyManager) KeyID() (string, error) {
+	return "", sputnikkeymanager.ErrNoKeyID
+}
+
+func TestAuditedSignatureRequiresKeyID(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	config := NewRequestConfig("1", "containerID", "public")
+	r := New(config, keyIDlessKeyManager{}, WithAuditLog(audit.Open("./testFiles/audit.jsonl")))
+
+	signature, err := r.SignatureForMessage([]byte("message"))
+	assert.Nil(t, signature)
+	assert.True(t, errors.Is(err, sputnikkeymanager.ErrNoKeyID), "A signature must not be logged without its Key ID")
+}
+
+func TestUnloggedRequestsAreRefused(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	assert.Nil(t, os.MkdirAll("./testFiles/audit.jsonl", 0700))
+	config := NewRequestConfig("1", "containerID", "public")
+	r := New(config, keymanagertest.KeyManager(), WithAuditLog(audit.Open("./testFiles/audit.jsonl")))
+
+	request, err := r.PostRequest("modify", "{}")
+	assert.Nil(t, request)
+	assert.NotNil(t, err, "A request whose signature can't be logged should not be handed out")
+}
+
+func TestFallbackSignsWithPreviousIdentity(t *testing.T) {
+	defer os.RemoveAll("./testFiles")
+	manager := sputnikkeymanager.NewWithSecretsFolder("./testFiles", "keyid.txt", "eckey.pem")
+	assert.Nil(t, manager.CreateSigningIdentity())
+	assert.Nil(t, manager.StoreKeyID("old key id"))
+	_, _ = manager.StageSigningIdentity(nil)
+	assert.Nil(t, manager.CompleteRotation("new key id", time.Hour))
+
+	requestManager := New(NewRequestConfig("1", "containerID", "public"), &manager)
+	request, _ := requestManager.PostRequest("modify", "{}")
+	assert.Equal(t, "new key id", request.Header.Get("X-Apple-CloudKit-Request-KeyID"))
+
+	fallback, err := requestManager.Fallback()
+	assert.Nil(t, err)
+	request, err = fallback.PostRequest("modify", "{}")
+	assert.Nil(t, err)
+	assert.Equal(t, "old key id", request.Header.Get("X-Apple-CloudKit-Request-KeyID"), "A rejected request should be retried with the previous identity")
+}
+
+func TestFallbackWithoutPreviousIdentity(t *testing.T) {
+	_, err := New(NewRequestConfig("1", "containerID", "public"), keymanagertest.KeyManager()).Fallback()
+	assert.True(t, errors.Is(err, sputnikkeymanager.ErrNoIdentity))
+}